@@ -3,6 +3,7 @@ package controller
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -15,11 +16,13 @@ import (
 	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
 	handlers "github.com/supercaracal/aws-sqs-worker-job-controller/internal/handler"
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
 	workers "github.com/supercaracal/aws-sqs-worker-job-controller/internal/worker"
 	customclient "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/clientset/versioned"
 	customscheme "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/clientset/versioned/scheme"
@@ -29,8 +32,8 @@ import (
 
 const (
 	informerReSyncDuration = 10 * time.Second
-	cleanupDuration        = 10 * time.Second
-	consumingDuration      = 1 * time.Second
+	workingDuration        = 1 * time.Second
+	resourceKind           = "AWSSQSWorkerJob"
 	resourceName           = "AWSSQSWorkerJobs"
 	controllerName         = "aws-sqs-worker-job-controller"
 )
@@ -40,6 +43,8 @@ type CustomController struct {
 	builtin   *builtinTool
 	custom    *customTool
 	workQueue workqueue.RateLimitingInterface
+	lock      *resourcelock.LeaseLock
+	ready     int32
 }
 
 type builtinTool struct {
@@ -89,11 +94,21 @@ func NewCustomController(cfg *rest.Config) (*CustomController, error) {
 		DeleteFunc: h.OnDelete,
 	})
 
+	oh := handlers.NewOwnedInformerHandler(wq, resourceKind)
+	builtin.job.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    oh.OnAdd,
+		UpdateFunc: oh.OnUpdate,
+		DeleteFunc: oh.OnDelete,
+	})
+	builtin.job.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: workers.ObserveJobTransition,
+	})
+
 	return &CustomController{builtin: builtin, custom: custom, workQueue: wq}, nil
 }
 
 // Run is
-func (c *CustomController) Run(stopCh <-chan struct{}) error {
+func (c *CustomController) Run(stopCh <-chan struct{}, concurrency int) error {
 	defer utilruntime.HandleCrash()
 	defer c.workQueue.ShutDown()
 
@@ -130,20 +145,65 @@ func (c *CustomController) Run(stopCh <-chan struct{}) error {
 		recorder,
 	)
 
-	if err := worker.WithMessageQueueService(os.Getenv("AWS_REGION"), os.Getenv("AWS_ENDPOINT_URL")); err != nil {
+	reg, err := buildQueueRegistry()
+	if err != nil {
 		return err
 	}
+	worker.WithQueueRegistry(reg)
 
-	go wait.Until(worker.Consume, consumingDuration, stopCh)
-	go wait.Until(worker.Clean, cleanupDuration, stopCh)
-
+	c.setReady(true)
 	klog.V(4).Info("Controller is ready")
-	<-stopCh
-	klog.V(4).Info("Shutting down controller")
+
+	// Everything is stopped before returning so that another leader never runs at the same time.
+	run := func(stopCh <-chan struct{}) {
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				wait.Until(worker.Work, workingDuration, stopCh)
+			}()
+		}
+		<-stopCh
+
+		klog.V(4).Info("Shutting down controller")
+		c.setReady(false)
+		c.workQueue.ShutDown()
+		wg.Wait()
+		worker.StopConsumers()
+	}
+
+	if c.lock == nil {
+		run(stopCh)
+	} else {
+		c.runAsLeader(stopCh, run)
+	}
 
 	return nil
 }
 
+// New backends are available by registering them with the scheme of their URLs.
+func buildQueueRegistry() (*queues.Registry, error) {
+	reg := queues.NewRegistry()
+
+	sqs, err := queues.NewSQSOpener(os.Getenv("AWS_REGION"), os.Getenv("AWS_ENDPOINT_URL"))
+	if err != nil {
+		return nil, err
+	}
+	reg.Register("https", sqs)
+	reg.Register("http", sqs)
+
+	amqp := queues.NewAMQPOpener()
+	reg.Register("amqps", amqp)
+	reg.Register("amqp", amqp)
+
+	redis := queues.NewRedisOpener()
+	reg.Register("rediss", redis)
+	reg.Register("redis", redis)
+
+	return reg, nil
+}
+
 func buildBuiltinTools(cfg *rest.Config) (*builtinTool, error) {
 	cli, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// HealthHandler is
+func (c *CustomController) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeProbeResult(w, true)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		writeProbeResult(w, c.isReady())
+	})
+
+	return mux
+}
+
+func (c *CustomController) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&c.ready, v)
+}
+
+func (c *CustomController) isReady() bool {
+	return atomic.LoadInt32(&c.ready) == 1
+}
+
+func writeProbeResult(w http.ResponseWriter, ok bool) {
+	if !ok {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok")) // nolint:errcheck
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	c := &CustomController{}
+	h := c.HealthHandler()
+
+	cases := []struct {
+		ready bool
+		path  string
+		want  int
+	}{
+		{false, "/healthz", http.StatusOK},
+		{false, "/readyz", http.StatusServiceUnavailable},
+		{true, "/healthz", http.StatusOK},
+		{true, "/readyz", http.StatusOK},
+	}
+
+	for i, c1 := range cases {
+		c.setReady(c1.ready)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", c1.path, nil))
+		if rec.Code != c1.want {
+			t.Errorf("%d: want=%d, got=%d", i, c1.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// WithLeaderElection is
+func (c *CustomController) WithLeaderElection(namespace, name string) error {
+	if namespace == "" || name == "" {
+		return fmt.Errorf("Unable to elect leader without namespace and name of the Lease")
+	}
+
+	id, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("Failed to get identity for leader election: %w", err)
+	}
+
+	c.lock = &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     c.builtin.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: id},
+	}
+
+	return nil
+}
+
+// The lease is released when the context is canceled, so that it is canceled after run returns while leading.
+func (c *CustomController) runAsLeader(stopCh <-chan struct{}, run func(<-chan struct{})) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var leading, stopping bool
+
+	go func() {
+		<-stopCh
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		stopping = true
+		if !leading {
+			cancel()
+		}
+	}()
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            c.lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            controllerName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leadingCtx context.Context) {
+				mu.Lock()
+				if stopping {
+					mu.Unlock()
+					return
+				}
+				leading = true
+				mu.Unlock()
+
+				klog.Infof("Started leading as %s", c.lock.Identity())
+				run(mergeStopChannels(stopCh, leadingCtx.Done()))
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					return
+				}
+				// Another replica may already be consuming the same queues.
+				klog.Fatalf("Lost leadership as %s", c.lock.Identity())
+			},
+			OnNewLeader: func(id string) {
+				klog.V(4).Infof("Current leader is %s", id)
+			},
+		},
+	})
+}
+
+func mergeStopChannels(a, b <-chan struct{}) <-chan struct{} {
+	merged := make(chan struct{})
+	go func() {
+		defer close(merged)
+		select {
+		case <-a:
+		case <-b:
+		}
+	}()
+
+	return merged
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWithLeaderElection(t *testing.T) {
+	cases := []struct {
+		namespace string
+		name      string
+		wantErr   bool
+	}{
+		{"default", "foo", false},
+		{"", "foo", true},
+		{"default", "", true},
+	}
+
+	for i, c := range cases {
+		ctrl := &CustomController{builtin: &builtinTool{client: kubefake.NewSimpleClientset()}}
+		err := ctrl.WithLeaderElection(c.namespace, c.name)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%d: wantErr=%t, got=%v", i, c.wantErr, err)
+			continue
+		}
+		if err == nil && (ctrl.lock.LeaseMeta.Namespace != c.namespace || ctrl.lock.LeaseMeta.Name != c.name) {
+			t.Errorf("%d: unexpected lease: %+v", i, ctrl.lock.LeaseMeta)
+		}
+	}
+}
+
+func TestRunAsLeader(t *testing.T) {
+	cli := kubefake.NewSimpleClientset()
+	ctrl := &CustomController{builtin: &builtinTool{client: cli}}
+	if err := ctrl.WithLeaderElection("default", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	holder := func() string {
+		lease, err := cli.CoordinationV1().Leases("default").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if err != nil || lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *lease.Spec.HolderIdentity
+	}
+
+	stopCh := make(chan struct{})
+	started := make(chan struct{})
+	var heldWhileStopping string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctrl.runAsLeader(stopCh, func(ch <-chan struct{}) {
+			close(started)
+			<-ch
+			// The consumers are stopped here while the lease is still held.
+			time.Sleep(500 * time.Millisecond)
+			heldWhileStopping = holder()
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("it should start leading")
+	}
+
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("it should return after stopping")
+	}
+
+	if id := ctrl.lock.Identity(); heldWhileStopping != id {
+		t.Errorf("lease should be held until run returns: want=%s, got=%s", id, heldWhileStopping)
+	}
+	if got := holder(); got != "" {
+		t.Errorf("lease should be released after run returns: %s", got)
+	}
+}
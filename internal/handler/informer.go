@@ -14,11 +14,17 @@ import (
 // InformerHandler is
 type InformerHandler struct {
 	workQueue workqueue.RateLimitingInterface
+	keyFunc   func(metav1.Object) (string, error)
 }
 
 // NewInformerHandler is
 func NewInformerHandler(wq workqueue.RateLimitingInterface) *InformerHandler {
-	return &InformerHandler{workQueue: wq}
+	return &InformerHandler{workQueue: wq, keyFunc: objectKeyFunc}
+}
+
+// NewOwnedInformerHandler is
+func NewOwnedInformerHandler(wq workqueue.RateLimitingInterface, ownerKind string) *InformerHandler {
+	return &InformerHandler{workQueue: wq, keyFunc: buildOwnerKeyFunc(ownerKind)}
 }
 
 // OnAdd is
@@ -64,9 +70,30 @@ func (h *InformerHandler) handleObject(obj interface{}, event string) error {
 	}
 
 	klog.V(4).Infof("%s object %s/%s", event, object.GetNamespace(), object.GetName())
-	if event == "Deleted" {
-		return nil
+
+	key, err := h.keyFunc(object)
+	if err != nil {
+		return err
+	}
+
+	if key != "" {
+		h.workQueue.Add(key)
 	}
 
 	return nil
 }
+
+func objectKeyFunc(object metav1.Object) (string, error) {
+	return cache.MetaNamespaceKeyFunc(object)
+}
+
+func buildOwnerKeyFunc(kind string) func(metav1.Object) (string, error) {
+	return func(object metav1.Object) (string, error) {
+		ref := metav1.GetControllerOf(object)
+		if ref == nil || ref.Kind != kind {
+			return "", nil
+		}
+
+		return object.GetNamespace() + "/" + ref.Name, nil
+	}
+}
@@ -2,7 +2,90 @@ package handler
 
 import (
 	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
 )
 
-func TestTODO(t *testing.T) {
+func TestInformerHandler(t *testing.T) {
+	before := &customapiv1.AWSSQSWorkerJob{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", ResourceVersion: "1"}}
+	after := before.DeepCopy()
+	after.ResourceVersion = "2"
+
+	cases := []struct {
+		desc string
+		do   func(*InformerHandler)
+		want []string
+	}{
+		{desc: "added", do: func(h *InformerHandler) { h.OnAdd(before) }, want: []string{"default/foo"}},
+		{desc: "updated", do: func(h *InformerHandler) { h.OnUpdate(before, after) }, want: []string{"default/foo"}},
+		{desc: "not changed", do: func(h *InformerHandler) { h.OnUpdate(before, before) }, want: []string{}},
+		{desc: "deleted", do: func(h *InformerHandler) { h.OnDelete(before) }, want: []string{"default/foo"}},
+		{desc: "deleted with tombstone", do: func(h *InformerHandler) { h.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/foo", Obj: before}) }, want: []string{"default/foo"}},
+		{desc: "invalid object", do: func(h *InformerHandler) { h.OnAdd("foo") }, want: []string{}},
+	}
+
+	for n, c := range cases {
+		wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		c.do(NewInformerHandler(wq))
+
+		if wq.Len() != len(c.want) {
+			t.Errorf("%d: %s: want=%d, got=%d", n, c.desc, len(c.want), wq.Len())
+		}
+
+		for _, want := range c.want {
+			got, _ := wq.Get()
+			if got != want {
+				t.Errorf("%d: %s: want=%s, got=%v", n, c.desc, want, got)
+			}
+			wq.Done(got)
+		}
+
+		wq.ShutDown()
+	}
+}
+
+func TestOwnedInformerHandler(t *testing.T) {
+	owner := &customapiv1.AWSSQSWorkerJob{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"}}
+	owned := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-1",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, customapiv1.SchemeGroupVersion.WithKind("AWSSQSWorkerJob"))},
+		},
+	}
+	orphan := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"}}
+
+	cases := []struct {
+		desc string
+		obj  interface{}
+		want []string
+	}{
+		{desc: "owned", obj: owned, want: []string{"default/foo"}},
+		{desc: "orphan", obj: orphan, want: []string{}},
+		{desc: "owned with tombstone", obj: cache.DeletedFinalStateUnknown{Key: "default/foo-1", Obj: owned}, want: []string{"default/foo"}},
+	}
+
+	for n, c := range cases {
+		wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		NewOwnedInformerHandler(wq, "AWSSQSWorkerJob").OnDelete(c.obj)
+
+		if wq.Len() != len(c.want) {
+			t.Errorf("%d: %s: want=%d, got=%d", n, c.desc, len(c.want), wq.Len())
+		}
+
+		for _, want := range c.want {
+			got, _ := wq.Get()
+			if got != want {
+				t.Errorf("%d: %s: want=%s, got=%v", n, c.desc, want, got)
+			}
+			wq.Done(got)
+		}
+
+		wq.ShutDown()
+	}
 }
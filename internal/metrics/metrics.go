@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "aws_sqs_worker_job_controller"
+)
+
+var (
+	resourceLabels  = []string{"namespace", "name"}
+	operationLabels = []string{"namespace", "name", "operation"}
+
+	// MessagesReceived is
+	MessagesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "The number of messages received from the queue.",
+	}, resourceLabels)
+
+	// MessagesDeleted is
+	MessagesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_deleted_total",
+		Help:      "The number of messages deleted from the queue.",
+	}, resourceLabels)
+
+	// JobsCreated is
+	JobsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_created_total",
+		Help:      "The number of child jobs created.",
+	}, resourceLabels)
+
+	// JobsSucceeded is
+	JobsSucceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_succeeded_total",
+		Help:      "The number of child jobs succeeded.",
+	}, resourceLabels)
+
+	// JobsFailed is
+	JobsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_failed_total",
+		Help:      "The number of child jobs failed.",
+	}, resourceLabels)
+
+	// JobsDeleted is
+	JobsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_deleted_total",
+		Help:      "The number of finished child jobs deleted by the cleanup.",
+	}, resourceLabels)
+
+	// QueueErrors is
+	QueueErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sqs_api_errors_total",
+		Help:      "The number of failed API calls to the queue.",
+	}, operationLabels)
+
+	// QueueLatency is
+	QueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sqs_api_duration_seconds",
+		Help:      "The latency of API calls to the queue.",
+		Buckets:   prometheus.DefBuckets,
+	}, operationLabels)
+
+	// QueueBacklog is
+	QueueBacklog = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_approximate_backlog",
+		Help:      "The approximate number of messages available in the queue.",
+	}, resourceLabels)
+
+	// JobStartLatency is
+	JobStartLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "message_to_job_start_seconds",
+		Help:      "The duration from sending the message to starting the child job.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, resourceLabels)
+
+	registry = prometheus.NewRegistry()
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		MessagesReceived,
+		MessagesDeleted,
+		JobsCreated,
+		JobsSucceeded,
+		JobsFailed,
+		JobsDeleted,
+		QueueErrors,
+		QueueLatency,
+		QueueBacklog,
+		JobStartLatency,
+	)
+}
+
+// Handler is
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Forget is
+func Forget(namespace, name string) {
+	QueueBacklog.DeleteLabelValues(namespace, name)
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	QueueBacklog.WithLabelValues("default", "foo").Set(3)
+	defer Forget("default", "foo")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("want=%d, got=%d", 200, rec.Code)
+	}
+
+	want := `aws_sqs_worker_job_controller_queue_approximate_backlog{name="foo",namespace="default"} 3`
+	if body := rec.Body.String(); !strings.Contains(body, want) {
+		t.Errorf("%s is not found in:\n%s", want, body)
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"time"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+)
+
+// InstrumentedQueue is
+type InstrumentedQueue struct {
+	queue     queues.MessageQueue
+	namespace string
+	name      string
+}
+
+// NewInstrumentedQueue is
+func NewInstrumentedQueue(q queues.MessageQueue, namespace, name string) *InstrumentedQueue {
+	return &InstrumentedQueue{queue: q, namespace: namespace, name: name}
+}
+
+// Receive is
+func (q *InstrumentedQueue) Receive(queueURL string, opts *queues.ReceiveOptions) ([]*queues.Message, error) {
+	start := time.Now()
+	msgs, err := q.queue.Receive(queueURL, opts)
+	q.observe("ReceiveMessage", start, err)
+	if err == nil {
+		MessagesReceived.WithLabelValues(q.namespace, q.name).Add(float64(len(msgs)))
+	}
+
+	return msgs, err
+}
+
+// Delete is
+func (q *InstrumentedQueue) Delete(queueURL string, receiptHandles ...string) error {
+	start := time.Now()
+	err := q.queue.Delete(queueURL, receiptHandles...)
+	q.observe("DeleteMessage", start, err)
+	if deleted := len(receiptHandles) - len(queues.FailedReceiptHandles(err, receiptHandles)); deleted > 0 {
+		MessagesDeleted.WithLabelValues(q.namespace, q.name).Add(float64(deleted))
+	}
+
+	return err
+}
+
+// ExtendVisibility is
+func (q *InstrumentedQueue) ExtendVisibility(queueURL, receiptHandle string, timeout time.Duration) error {
+	start := time.Now()
+	err := q.queue.ExtendVisibility(queueURL, receiptHandle, timeout)
+	q.observe("ChangeMessageVisibility", start, err)
+	return err
+}
+
+// Send is
+func (q *InstrumentedQueue) Send(queueURL string, msg *queues.Message) error {
+	start := time.Now()
+	err := q.queue.Send(queueURL, msg)
+	q.observe("SendMessage", start, err)
+	return err
+}
+
+// CountMessages is
+func (q *InstrumentedQueue) CountMessages(queueURL string) (int, error) {
+	start := time.Now()
+	n, err := q.queue.CountMessages(queueURL)
+	q.observe("GetQueueAttributes", start, err)
+	if err == nil {
+		QueueBacklog.WithLabelValues(q.namespace, q.name).Set(float64(n))
+	}
+
+	return n, err
+}
+
+func (q *InstrumentedQueue) observe(operation string, start time.Time, err error) {
+	QueueLatency.WithLabelValues(q.namespace, q.name, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		QueueErrors.WithLabelValues(q.namespace, q.name, operation).Inc()
+	}
+}
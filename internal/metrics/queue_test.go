@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+)
+
+type fakeQueue struct {
+	err error
+}
+
+func (q *fakeQueue) Receive(_ string, _ *queues.ReceiveOptions) ([]*queues.Message, error) {
+	return []*queues.Message{{ID: "1"}, {ID: "2"}}, q.err
+}
+
+func (q *fakeQueue) Delete(_ string, _ ...string) error {
+	return q.err
+}
+
+func (q *fakeQueue) ExtendVisibility(_, _ string, _ time.Duration) error {
+	return q.err
+}
+
+func (q *fakeQueue) Send(_ string, _ *queues.Message) error {
+	return q.err
+}
+
+func (q *fakeQueue) CountMessages(_ string) (int, error) {
+	return 5, q.err
+}
+
+func TestInstrumentedQueue(t *testing.T) {
+	q := NewInstrumentedQueue(&fakeQueue{}, "default", "instrumented")
+
+	if _, err := q.Receive("foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Delete("foo", "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.CountMessages("foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		got  float64
+		want float64
+	}{
+		{testutil.ToFloat64(MessagesReceived.WithLabelValues("default", "instrumented")), 2},
+		{testutil.ToFloat64(MessagesDeleted.WithLabelValues("default", "instrumented")), 3},
+		{testutil.ToFloat64(QueueBacklog.WithLabelValues("default", "instrumented")), 5},
+	}
+
+	for i, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%d: want=%f, got=%f", i, c.want, c.got)
+		}
+	}
+}
+
+func TestInstrumentedQueueWithError(t *testing.T) {
+	q := NewInstrumentedQueue(&fakeQueue{err: fmt.Errorf("error")}, "default", "failing")
+
+	if err := q.Send("foo", &queues.Message{}); err == nil {
+		t.Fatal("error is expected")
+	}
+	if err := q.ExtendVisibility("foo", "a", time.Second); err == nil {
+		t.Fatal("error is expected")
+	}
+
+	if got := testutil.ToFloat64(QueueErrors.WithLabelValues("default", "failing", "SendMessage")); got != 1 {
+		t.Errorf("want=%d, got=%f", 1, got)
+	}
+	if got := testutil.ToFloat64(QueueErrors.WithLabelValues("default", "failing", "ChangeMessageVisibility")); got != 1 {
+		t.Errorf("want=%d, got=%f", 1, got)
+	}
+}
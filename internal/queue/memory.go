@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultVisibilityTimeout is the same as the default of SQS
+	DefaultVisibilityTimeout = 30 * time.Second
+
+	deduplicationInterval = 5 * time.Minute
+)
+
+// MemoryQueue is
+type MemoryQueue struct {
+	queues            map[string]*memoryQueue
+	visibilityTimeout time.Duration
+	now               func() time.Time
+	seq               int
+	mu                sync.Mutex
+}
+
+type memoryQueue struct {
+	messages     []*memoryMessage
+	deduplicated map[string]time.Time
+}
+
+type memoryMessage struct {
+	msg       Message
+	visibleAt time.Time
+	inFlight  bool
+}
+
+// NewMemoryQueue is
+func NewMemoryQueue(visibilityTimeout time.Duration) *MemoryQueue {
+	return &MemoryQueue{queues: make(map[string]*memoryQueue), visibilityTimeout: visibilityTimeout, now: time.Now}
+}
+
+// Receive is
+// It returns immediately even if the wait time is given.
+func (q *MemoryQueue) Receive(queueURL string, opts *ReceiveOptions) ([]*Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	size, _ := normalizeReceiveOptions(opts)
+	mq := q.queueFor(queueURL)
+	now := q.now()
+
+	// Messages in a group are delivered in order, so that the group is blocked while any of them is in flight.
+	blocked := make(map[string]struct{})
+	if isFIFO(queueURL) {
+		for _, m := range mq.messages {
+			if m.inFlight && now.Before(m.visibleAt) {
+				blocked[m.msg.GroupID] = struct{}{}
+			}
+		}
+	}
+
+	msgs := make([]*Message, 0, size)
+	for _, m := range mq.messages {
+		if len(msgs) == size {
+			break
+		}
+
+		if now.Before(m.visibleAt) {
+			continue
+		}
+
+		if _, ok := blocked[m.msg.GroupID]; ok && isFIFO(queueURL) {
+			continue
+		}
+
+		q.seq++
+		m.msg.ReceiveCount++
+		m.msg.ReceiptHandle = fmt.Sprintf("%s#%d", m.msg.ID, q.seq)
+		m.visibleAt = now.Add(q.visibilityTimeout)
+		m.inFlight = true
+
+		msg := m.msg
+		msgs = append(msgs, &msg)
+	}
+
+	return msgs, nil
+}
+
+// Delete is
+func (q *MemoryQueue) Delete(queueURL string, receiptHandles ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	mq := q.queueFor(queueURL)
+	failed := make([]string, 0)
+	for _, h := range receiptHandles {
+		if !isValidReceiptHandle(h) {
+			failed = append(failed, h)
+			continue
+		}
+
+		// Stale handles are ignored as SQS does since the message might have been deleted or received again.
+		if i := mq.indexOf(h); i >= 0 {
+			mq.messages = append(mq.messages[:i], mq.messages[i+1:]...)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &DeleteError{ReceiptHandles: failed, Err: fmt.Errorf("receipt handle %s is invalid", failed[0])}
+	}
+
+	return nil
+}
+
+// ExtendVisibility is
+func (q *MemoryQueue) ExtendVisibility(queueURL, receiptHandle string, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	mq := q.queueFor(queueURL)
+	i := mq.indexOf(receiptHandle)
+	if i < 0 {
+		return fmt.Errorf("Failed to change visibility timeout: receipt handle %s is invalid", receiptHandle)
+	}
+
+	m := mq.messages[i]
+	m.visibleAt = q.now().Add(timeout)
+	m.inFlight = timeout > 0
+
+	return nil
+}
+
+// Send is
+func (q *MemoryQueue) Send(queueURL string, msg *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	mq := q.queueFor(queueURL)
+	now := q.now()
+
+	q.seq++
+	m := memoryMessage{msg: Message{ID: strconv.Itoa(q.seq), Body: msg.Body, SentTimestamp: now}}
+	if len(msg.Attributes) > 0 {
+		m.msg.Attributes = make(map[string]string, len(msg.Attributes))
+		for k, v := range msg.Attributes {
+			m.msg.Attributes[k] = v
+		}
+	}
+
+	// It follows the convention of the SQS client that uses the message ID for the group and deduplication.
+	if isFIFO(queueURL) {
+		m.msg.GroupID, m.msg.DeduplicationID = msg.GroupID, msg.DeduplicationID
+		if m.msg.GroupID == "" {
+			m.msg.GroupID = msg.ID
+		}
+		if m.msg.DeduplicationID == "" {
+			m.msg.DeduplicationID = msg.ID
+		}
+		if m.msg.GroupID == "" || m.msg.DeduplicationID == "" {
+			return fmt.Errorf("Failed to send message: group ID and deduplication ID are required for FIFO queue")
+		}
+
+		if sent, ok := mq.deduplicated[m.msg.DeduplicationID]; ok && now.Sub(sent) < deduplicationInterval {
+			return nil
+		}
+		mq.deduplicated[m.msg.DeduplicationID] = now
+	}
+
+	mq.messages = append(mq.messages, &m)
+	return nil
+}
+
+// CountMessages is
+func (q *MemoryQueue) CountMessages(queueURL string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	var n int
+	for _, m := range q.queueFor(queueURL).messages {
+		if !now.Before(m.visibleAt) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Queues are created implicitly.
+func (q *MemoryQueue) queueFor(queueURL string) *memoryQueue {
+	mq, ok := q.queues[queueURL]
+	if !ok {
+		mq = &memoryQueue{deduplicated: make(map[string]time.Time)}
+		q.queues[queueURL] = mq
+	}
+
+	return mq
+}
+
+func (mq *memoryQueue) indexOf(receiptHandle string) int {
+	for i, m := range mq.messages {
+		if m.msg.ReceiptHandle == receiptHandle && receiptHandle != "" {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isValidReceiptHandle(receiptHandle string) bool {
+	i := strings.LastIndex(receiptHandle, "#")
+	if i <= 0 {
+		return false
+	}
+
+	_, err := strconv.ParseUint(receiptHandle[i+1:], 10, 64)
+	return err == nil
+}
+
+func isFIFO(queueURL string) bool {
+	return strings.HasSuffix(queueURL, fifoSuffix)
+}
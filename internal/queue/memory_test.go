@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	now := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	q := NewMemoryQueue(DefaultVisibilityTimeout)
+	q.now = func() time.Time { return now }
+
+	url := "http://127.0.0.1:4566/000000000000/test-queue"
+	for _, body := range []string{"foo", "bar"} {
+		if err := q.Send(url, &Message{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err := q.Receive(url, &ReceiveOptions{MaxMessages: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Body != "foo" || msgs[0].ReceiveCount != 1 {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+	first := msgs[0].ReceiptHandle
+
+	if n, _ := q.CountMessages(url); n != 1 {
+		t.Errorf("in-flight message should not be counted: want=1, got=%d", n)
+	}
+
+	now = now.Add(DefaultVisibilityTimeout)
+	msgs, err = q.Receive(url, &ReceiveOptions{MaxMessages: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Body != "foo" || msgs[0].ReceiveCount != 2 {
+		t.Fatalf("message should be redelivered after visibility timeout: %+v", msgs)
+	}
+
+	if err := q.Delete(url, first); err != nil {
+		t.Errorf("stale receipt handle should be ignored: %v", err)
+	}
+	if err := q.Delete(url, "invalid"); err == nil {
+		t.Error("malformed receipt handle should be invalid")
+	}
+	if err := q.ExtendVisibility(url, msgs[1].ReceiptHandle, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Delete(url, msgs[0].ReceiptHandle); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err = q.Receive(url, &ReceiveOptions{MaxMessages: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Body != "bar" {
+		t.Fatalf("released message should be visible immediately: %+v", msgs)
+	}
+}
+
+func TestMemoryQueueFIFO(t *testing.T) {
+	q := NewMemoryQueue(DefaultVisibilityTimeout)
+	url := "http://127.0.0.1:4566/000000000000/test-queue.fifo"
+
+	cases := []struct {
+		msg     Message
+		wantErr bool
+	}{
+		{Message{ID: "1", GroupID: "a", Body: "a1"}, false},
+		{Message{ID: "2", GroupID: "a", Body: "a2"}, false},
+		{Message{ID: "3", GroupID: "b", Body: "b1"}, false},
+		{Message{ID: "3", GroupID: "b", Body: "duplicated"}, false},
+		{Message{Body: "no group"}, true},
+	}
+
+	for i, c := range cases {
+		if err := q.Send(url, &c.msg); (err != nil) != c.wantErr {
+			t.Errorf("%d: wantErr=%t, got=%v", i, c.wantErr, err)
+		}
+	}
+
+	// Messages of a group in flight block the following ones of the group.
+	steps := []struct {
+		max    int
+		bodies []string
+	}{
+		{1, []string{"a1"}},
+		{10, []string{"b1"}},
+		{10, []string{"a2"}},
+		{10, []string{}},
+	}
+
+	var first string
+	for i, step := range steps {
+		msgs, err := q.Receive(url, &ReceiveOptions{MaxMessages: step.max})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(msgs) != len(step.bodies) {
+			t.Errorf("%d: want=%v, got=%d messages", i, step.bodies, len(msgs))
+			continue
+		}
+		for j, msg := range msgs {
+			if msg.Body != step.bodies[j] {
+				t.Errorf("%d: %d: want=%s, got=%s", i, j, step.bodies[j], msg.Body)
+			}
+		}
+
+		// The group of the first message is released at the next step.
+		switch i {
+		case 0:
+			first = msgs[0].ReceiptHandle
+		case 1:
+			if err := q.Delete(url, first); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
@@ -1,6 +1,69 @@
 package queue
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 // MessageQueue is
 type MessageQueue interface {
-	Dequeue(string) (string, error)
+	Receive(string, *ReceiveOptions) ([]*Message, error)
+	Delete(string, ...string) error
+	ExtendVisibility(string, string, time.Duration) error
+	Send(string, *Message) error
+	CountMessages(string) (int, error)
+}
+
+// ReceiveOptions is
+type ReceiveOptions struct {
+	// The maximum number of messages received at once.
+	MaxMessages int
+	// The duration to wait for messages arriving when the queue is empty.
+	WaitTime time.Duration
+	// The upper limit of messages received and not deleted yet, or zero for no limit.
+	// It is only used by the queues which deliver messages in advance such as AMQP.
+	MaxInFlight int
+}
+
+// Message is
+type Message struct {
+	ID              string
+	Body            string
+	ReceiptHandle   string
+	SentTimestamp   time.Time
+	ReceiveCount    int
+	GroupID         string
+	DeduplicationID string
+	Attributes      map[string]string
+}
+
+// DeleteError is
+// It is returned by Delete when some of the messages are not deleted.
+type DeleteError struct {
+	ReceiptHandles []string
+	Err            error
+}
+
+func (e *DeleteError) Error() string {
+	return fmt.Sprintf("Failed to delete %d messages: %v", len(e.ReceiptHandles), e.Err)
+}
+
+func (e *DeleteError) Unwrap() error {
+	return e.Err
+}
+
+// FailedReceiptHandles is
+// It returns the receipt handles of the messages which are not deleted by the error of Delete.
+func FailedReceiptHandles(err error, receiptHandles []string) []string {
+	if err == nil {
+		return nil
+	}
+
+	var deleteErr *DeleteError
+	if errors.As(err, &deleteErr) {
+		return deleteErr.ReceiptHandles
+	}
+
+	return receiptHandles
 }
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseRedisURL(t *testing.T) {
+	cases := []struct {
+		url     string
+		addr    string
+		db      int
+		want    *RedisStream
+		wantErr bool
+	}{
+		{"redis://redis/foo?group=bar&consumer=baz", "redis:6379", 0, &RedisStream{Stream: "foo", Group: "bar", Consumer: "baz", MinIdleTime: DefaultRedisMinIdleTime}, false},
+		{"redis://:pass@redis:6380/2/foo%2Fbar?group=g&consumer=c&minIdleTime=30s", "redis:6380", 2, &RedisStream{Stream: "foo/bar", Group: "g", Consumer: "c", MinIdleTime: 30 * time.Second}, false},
+		{"rediss://redis/foo?consumer=c", "redis:6379", 0, &RedisStream{Stream: "foo", Consumer: "c", MinIdleTime: DefaultRedisMinIdleTime}, false},
+		{"redis://redis/foo?group=g&minIdleTime=0s", "", 0, nil, true},
+		{"redis://redis/foo?group=g&block=1", "", 0, nil, true},
+		{"redis://redis/db/foo?group=g", "", 0, nil, true},
+		{"redis://redis/0/foo/bar?group=g", "", 0, nil, true},
+		{"redis://redis/?group=g", "", 0, nil, true},
+		{"redis:///foo?group=g", "", 0, nil, true},
+		{"amqp://redis/foo?group=g", "", 0, nil, true},
+	}
+
+	for n, c := range cases {
+		opts, s, err := ParseRedisURL(c.url)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%d: wantErr=%t, got=%v", n, c.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if opts.Addr != c.addr || opts.DB != c.db {
+			t.Errorf("%d: want=(%s, %d), got=(%s, %d)", n, c.addr, c.db, opts.Addr, opts.DB)
+		}
+		if diff := cmp.Diff(c.want, s); diff != "" {
+			t.Errorf("%d: %s", n, diff)
+		}
+	}
+}
+
+func TestConvertEntry(t *testing.T) {
+	cases := []struct {
+		in    redis.XMessage
+		count int
+		want  *Message
+	}{
+		{
+			in:    redis.XMessage{ID: "1634515200000-0", Values: map[string]interface{}{"id": "foo", "body": "Hello", "TraceID": "abc"}},
+			count: 1,
+			want:  &Message{ID: "foo", Body: "Hello", ReceiptHandle: "1634515200000-0", SentTimestamp: time.Unix(1634515200, 0), ReceiveCount: 1, Attributes: map[string]string{"TraceID": "abc"}},
+		},
+		{
+			in:    redis.XMessage{ID: "1634515200001-3", Values: map[string]interface{}{"body": "Hello"}},
+			count: 3,
+			want:  &Message{ID: "1634515200001-3", Body: "Hello", ReceiptHandle: "1634515200001-3", SentTimestamp: time.Unix(1634515200, int64(time.Millisecond)), ReceiveCount: 3},
+		},
+	}
+
+	for n, c := range cases {
+		if diff := cmp.Diff(c.want, convertEntry(&c.in, c.count)); diff != "" {
+			t.Errorf("%d: %s", n, diff)
+		}
+	}
+}
+
+func TestRedisClient(t *testing.T) {
+	srv := miniredis.NewMiniRedis()
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	now := time.Now()
+	srv.SetTime(now)
+
+	base := "redis://" + srv.Addr() + "/"
+	qURL := base + "test-stream?group=test-group&consumer=test-consumer&minIdleTime=1m"
+	srv.XAdd("test-stream", "*", []string{"body", "Hello0"})
+
+	cli, err := NewRedisClient(qURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	for i := 1; i < 3; i++ {
+		msg := Message{ID: fmt.Sprintf("id%d", i), Body: fmt.Sprintf("Hello%d", i), Attributes: map[string]string{"Index": fmt.Sprint(i)}}
+		if err := cli.Send(base+"test-stream", &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// All of the entries are counted before the group is created on the first receive.
+	if n, err := cli.CountMessages(qURL); err != nil || n != 3 {
+		t.Errorf("want=%d, got=(%d, %v)", 3, n, err)
+	}
+
+	opts := &ReceiveOptions{MaxMessages: 2, WaitTime: 0}
+	first, err := cli.Receive(qURL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0].Body != "Hello0" || first[1].ID != "id1" || first[1].Attributes["Index"] != "1" {
+		t.Fatalf("unexpected messages: %+v", first)
+	}
+
+	if n, err := cli.CountMessages(qURL); err != nil || n != 1 {
+		t.Errorf("want=%d, got=(%d, %v)", 1, n, err)
+	}
+
+	if err := cli.Delete(qURL, first[0].ReceiptHandle); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := cli.Receive(qURL, opts); err != nil || len(msgs) != 1 || msgs[0].ID != "id2" {
+		t.Fatalf("unexpected messages: %+v, %v", msgs, err)
+	}
+
+	// The released entry is claimed again without waiting for the minimum idle time.
+	if err := cli.ExtendVisibility(qURL, first[1].ReceiptHandle, 0); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := cli.Receive(qURL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != "id1" || msgs[0].ReceiveCount < 2 {
+		t.Fatalf("released message should be redelivered: %+v", msgs)
+	}
+
+	// Extended entries are claimed after the timeout and the others are claimed after the minimum idle time.
+	if err := cli.ExtendVisibility(qURL, msgs[0].ReceiptHandle, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{29 * time.Second, 0},
+		{31 * time.Second, 1},
+		{61 * time.Second, 1},
+	} {
+		srv.SetTime(now.Add(step.elapsed))
+		msgs, err := cli.Receive(qURL, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != step.want {
+			t.Errorf("%d: want=%d, got=%+v", i, step.want, msgs)
+		}
+	}
+
+	if err := cli.Send(base+"non-existent-stream", &Message{Body: "Hello"}); err == nil {
+		t.Error("error is expected for non-existent stream")
+	}
+	if _, err := cli.Receive(base+"test-stream", opts); err == nil {
+		t.Error("error is expected without group")
+	}
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Opener is
+type Opener func(queueURL string) (MessageQueue, error)
+
+// Registry is
+type Registry struct {
+	openers map[string]Opener
+	mu      sync.RWMutex
+}
+
+// NewRegistry is
+func NewRegistry() *Registry {
+	return &Registry{openers: make(map[string]Opener)}
+}
+
+// Register is
+func (r *Registry) Register(scheme string, o Opener) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.openers[scheme] = o
+}
+
+// Open is
+func (r *Registry) Open(queueURL string) (MessageQueue, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse queue URL %s: %w", queueURL, err)
+	}
+
+	r.mu.RLock()
+	o, ok := r.openers[u.Scheme]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unable to open queue %s: unsupported scheme %q", u.Redacted(), u.Scheme)
+	}
+
+	return o(queueURL)
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+type nopQueue struct {
+	url string
+}
+
+func (q *nopQueue) Receive(string, *ReceiveOptions) ([]*Message, error)  { return nil, nil }
+func (q *nopQueue) Delete(string, ...string) error                       { return nil }
+func (q *nopQueue) ExtendVisibility(string, string, time.Duration) error { return nil }
+func (q *nopQueue) Send(string, *Message) error                          { return nil }
+func (q *nopQueue) CountMessages(string) (int, error)                    { return 0, nil }
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("foo", func(u string) (MessageQueue, error) { return &nopQueue{url: u}, nil })
+
+	cases := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"foo://localhost/bar", false},
+		{"bar://localhost/bar", true},
+		{"://", true},
+	}
+
+	for i, c := range cases {
+		q, err := reg.Open(c.url)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%d: wantErr=%t, got=%v", i, c.wantErr, err)
+			continue
+		}
+		if err == nil && q.(*nopQueue).url != c.url {
+			t.Errorf("%d: want=%s, got=%s", i, c.url, q.(*nopQueue).url)
+		}
+	}
+}
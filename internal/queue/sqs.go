@@ -3,17 +3,26 @@ package queue
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
 const (
-	dequeueSize    = 1
-	waitTimeout    = 0 // Don't block the loop
+	// MaxReceiveSize is the upper limit of the number of messages received at once
+	MaxReceiveSize = 10
+	// MaxWaitTime is the upper limit of the duration of long polling
+	MaxWaitTime = 20 * time.Second
+
 	requestTimeout = 10 * time.Second
+	fifoSuffix     = ".fifo"
+	attrDataType   = "String"
+	allAttributes  = "All"
 )
 
 // SQSClient is
@@ -31,6 +40,17 @@ func NewSQSClient(region, endpointURL string) (*SQSClient, error) {
 	return &SQSClient{cli: sqs.NewFromConfig(cfg)}, nil
 }
 
+// NewSQSOpener is
+func NewSQSOpener(region, endpointURL string) (Opener, error) {
+	cli, err := NewSQSClient(region, endpointURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// A client can treat any queues.
+	return func(string) (MessageQueue, error) { return cli, nil }, nil
+}
+
 func loadAWSConfig(region, endpointURL string) (aws.Config, error) {
 	if endpointURL == "" {
 		return config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
@@ -54,48 +74,232 @@ func loadAWSConfig(region, endpointURL string) (aws.Config, error) {
 	)
 }
 
-// Dequeue is
-func (s *SQSClient) Dequeue(queueURL string) (string, error) {
+// Receive is
+func (s *SQSClient) Receive(queueURL string, opts *ReceiveOptions) ([]*Message, error) {
+	size, wait := normalizeReceiveOptions(opts)
 	input := sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(queueURL),
-		MaxNumberOfMessages: dequeueSize,
-		WaitTimeSeconds:     waitTimeout,
+		QueueUrl:              aws.String(queueURL),
+		MaxNumberOfMessages:   int32(size),
+		WaitTimeSeconds:       int32(wait / time.Second),
+		AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+		MessageAttributeNames: []string{allAttributes},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout+wait)
 	defer cancel()
 
 	output, err := s.cli.ReceiveMessage(ctx, &input)
 	if err != nil {
-		return "", fmt.Errorf("Failed to receive message from AWS SQS: %w", err)
+		return nil, fmt.Errorf("Failed to receive message from AWS SQS: %w", err)
 	}
 
-	size := len(output.Messages)
-	if size == 0 {
-		return "", nil
+	if len(output.Messages) > size {
+		return nil, fmt.Errorf("Failed to receive messages from AWS SQS: too many messages: %d", len(output.Messages))
 	}
-	if size > dequeueSize {
-		return "", fmt.Errorf("Failed to receive a message from AWS SQS")
+
+	msgs := make([]*Message, 0, len(output.Messages))
+	for _, m := range output.Messages {
+		msgs = append(msgs, convertMessage(&m))
 	}
 
-	err = s.deleteMessage(ctx, aws.String(queueURL), output.Messages[0].ReceiptHandle)
-	if err != nil {
-		return "", err
+	return msgs, nil
+}
+
+func convertMessage(m *types.Message) *Message {
+	msg := Message{
+		ID:              aws.ToString(m.MessageId),
+		Body:            aws.ToString(m.Body),
+		ReceiptHandle:   aws.ToString(m.ReceiptHandle),
+		GroupID:         m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)],
+		DeduplicationID: m.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)],
+	}
+
+	if v, err := strconv.ParseInt(m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		msg.SentTimestamp = time.Unix(0, v*int64(time.Millisecond))
+	}
+
+	if v, err := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		msg.ReceiveCount = v
+	}
+
+	if len(m.MessageAttributes) > 0 {
+		msg.Attributes = make(map[string]string, len(m.MessageAttributes))
+		for k, v := range m.MessageAttributes {
+			if v.StringValue != nil { // binary values are not supported
+				msg.Attributes[k] = *v.StringValue
+			}
+		}
+	}
+
+	return &msg
+}
+
+// Delete is
+// It returns DeleteError with the receipt handles of the messages which are not deleted.
+func (s *SQSClient) Delete(queueURL string, receiptHandles ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if len(receiptHandles) == 1 {
+		input := sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueURL),
+			ReceiptHandle: aws.String(receiptHandles[0]),
+		}
+
+		if _, err := s.cli.DeleteMessage(ctx, &input); err != nil {
+			return &DeleteError{ReceiptHandles: receiptHandles, Err: fmt.Errorf("Failed to delete message from AWS SQS: %w", err)}
+		}
+
+		return nil
 	}
 
-	return *output.Messages[0].Body, nil
+	// The following batches are sent even if one of them fails.
+	var deleteErr *DeleteError
+	for i := 0; i < len(receiptHandles); i += MaxReceiveSize {
+		j := i + MaxReceiveSize
+		if j > len(receiptHandles) {
+			j = len(receiptHandles)
+		}
+
+		failed, err := s.deleteMessageBatch(ctx, queueURL, receiptHandles[i:j])
+		if err == nil {
+			continue
+		}
+
+		if deleteErr == nil {
+			deleteErr = &DeleteError{Err: err}
+		}
+		deleteErr.ReceiptHandles = append(deleteErr.ReceiptHandles, failed...)
+	}
+
+	if deleteErr != nil {
+		return deleteErr
+	}
+
+	return nil
 }
 
-func (s *SQSClient) deleteMessage(ctx context.Context, queueURL, identifier *string) error {
-	input := sqs.DeleteMessageInput{
-		QueueUrl:      queueURL,
-		ReceiptHandle: identifier,
+func (s *SQSClient) deleteMessageBatch(ctx context.Context, queueURL string, receiptHandles []string) ([]string, error) {
+	input := sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  make([]types.DeleteMessageBatchRequestEntry, 0, len(receiptHandles)),
 	}
 
-	_, err := s.cli.DeleteMessage(ctx, &input)
+	for i, handle := range receiptHandles {
+		input.Entries = append(input.Entries, types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: aws.String(handle),
+		})
+	}
+
+	output, err := s.cli.DeleteMessageBatch(ctx, &input)
 	if err != nil {
-		return fmt.Errorf("Failed to delete message from AWS SQS: %w", err)
+		return receiptHandles, fmt.Errorf("Failed to delete messages from AWS SQS: %w", err)
+	}
+
+	if len(output.Failed) == 0 {
+		return nil, nil
+	}
+
+	failed := make([]string, 0, len(output.Failed))
+	for _, e := range output.Failed {
+		if i, err := strconv.Atoi(aws.ToString(e.Id)); err == nil && i >= 0 && i < len(receiptHandles) {
+			failed = append(failed, receiptHandles[i])
+		}
+	}
+
+	return failed, fmt.Errorf("Failed to delete %d messages from AWS SQS: %s", len(output.Failed), aws.ToString(output.Failed[0].Message))
+}
+
+// ExtendVisibility is
+func (s *SQSClient) ExtendVisibility(queueURL, receiptHandle string, timeout time.Duration) error {
+	input := sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueURL),
+		ReceiptHandle:     aws.String(receiptHandle),
+		VisibilityTimeout: int32(timeout / time.Second),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if _, err := s.cli.ChangeMessageVisibility(ctx, &input); err != nil {
+		return fmt.Errorf("Failed to change message visibility on AWS SQS: %w", err)
+	}
+
+	return nil
+}
+
+// Send is
+func (s *SQSClient) Send(queueURL string, msg *Message) error {
+	input := sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(msg.Body),
+		MessageAttributes: make(map[string]types.MessageAttributeValue, len(msg.Attributes)),
+	}
+
+	for k, v := range msg.Attributes {
+		if v == "" {
+			continue // SQS rejects empty values
+		}
+		input.MessageAttributes[k] = types.MessageAttributeValue{DataType: aws.String(attrDataType), StringValue: aws.String(v)}
+	}
+
+	if strings.HasSuffix(queueURL, fifoSuffix) && msg.ID != "" {
+		input.MessageGroupId = aws.String(msg.ID)
+		input.MessageDeduplicationId = aws.String(msg.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if _, err := s.cli.SendMessage(ctx, &input); err != nil {
+		return fmt.Errorf("Failed to send message to AWS SQS: %w", err)
 	}
 
 	return nil
 }
+
+func normalizeReceiveOptions(opts *ReceiveOptions) (int, time.Duration) {
+	if opts == nil {
+		return 1, 0
+	}
+
+	size := opts.MaxMessages
+	if size < 1 {
+		size = 1
+	} else if size > MaxReceiveSize {
+		size = MaxReceiveSize
+	}
+
+	wait := opts.WaitTime
+	if wait < 0 {
+		wait = 0
+	} else if wait > MaxWaitTime {
+		wait = MaxWaitTime
+	}
+
+	return size, wait
+}
+
+// CountMessages is
+func (s *SQSClient) CountMessages(queueURL string) (int, error) {
+	input := sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	output, err := s.cli.GetQueueAttributes(ctx, &input)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get queue attributes from AWS SQS: %w", err)
+	}
+
+	n, err := strconv.Atoi(output.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get the number of messages from AWS SQS: %w", err)
+	}
+
+	return n, nil
+}
@@ -4,20 +4,44 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue/sqstest"
 )
 
 const (
-	testRegion      = "ap-northeast-1"
-	testEndpointURL = "http://127.0.0.1:4566"
+	testRegion = "ap-northeast-1"
+)
+
+var (
+	testEndpointURL string
 )
 
-func TestDequeue(t *testing.T) {
+func TestMain(m *testing.M) {
+	// The server doesn't verify signatures but the SDK needs credentials to sign requests.
+	for k, v := range map[string]string{"AWS_ACCESS_KEY_ID": "AAAAAAAAAAAAAAAAAAAA", "AWS_SECRET_ACCESS_KEY": "0000000000000000000000000000000000000000"} {
+		if os.Getenv(k) == "" {
+			os.Setenv(k, v)
+		}
+	}
+
+	srv := sqstest.NewServer()
+	testEndpointURL = srv.URL
+
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+func TestReceive(t *testing.T) {
 	cli, err := NewSQSClient(testRegion, testEndpointURL)
 	if err != nil {
 		t.Fatal(err)
@@ -40,7 +64,7 @@ func TestDequeue(t *testing.T) {
 				}
 				return enqueueForTest(t, cli, qURL, "test-queue1.fifo", `{"foo":"bar"}`)
 			},
-			queueURL: "http://127.0.0.1:4566/000000000000/test-queue1.fifo",
+			queueURL: testEndpointURL + "/000000000000/test-queue1.fifo",
 			want:     `{"foo":"bar"}`,
 			err:      nil,
 			clean:    func() error { return nil },
@@ -48,7 +72,7 @@ func TestDequeue(t *testing.T) {
 		{
 			desc:     "dequeue from non-existent queue",
 			prepare:  func() error { return nil },
-			queueURL: "http://127.0.0.1:4566/000000000000/test-queue2.fifo",
+			queueURL: testEndpointURL + "/000000000000/test-queue2.fifo",
 			want:     "",
 			err:      fmt.Errorf("Failed to receive message from AWS SQS"),
 			clean:    func() error { return nil },
@@ -59,7 +83,7 @@ func TestDequeue(t *testing.T) {
 				_, err := createQueueForTest(t, cli, "test-queue3.fifo")
 				return err
 			},
-			queueURL: "http://127.0.0.1:4566/000000000000/test-queue3.fifo",
+			queueURL: testEndpointURL + "/000000000000/test-queue3.fifo",
 			want:     "",
 			err:      nil,
 			clean:    func() error { return nil },
@@ -72,13 +96,18 @@ func TestDequeue(t *testing.T) {
 			continue
 		}
 
-		got, err := cli.Dequeue(c.queueURL)
+		msgs, err := cli.Receive(c.queueURL, nil)
 		if c.err != nil || err != nil {
 			if (c.err != nil && err == nil) || (c.err == nil && err != nil) || !strings.Contains(err.Error(), c.err.Error()) {
 				t.Error(fmt.Errorf("%d: %w", n, err))
 			}
 		}
 
+		var got string
+		if len(msgs) > 0 {
+			got = msgs[0].Body
+		}
+
 		if got != c.want {
 			t.Errorf("%d: want=%s, got=%s", n, c.want, got)
 		}
@@ -89,6 +118,316 @@ func TestDequeue(t *testing.T) {
 	}
 }
 
+func TestDelete(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qURL, err := createQueueForTest(t, cli, "test-queue4.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enqueueForTest(t, cli, qURL, "test-queue4.fifo", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := receiveOneForTest(t, cli, qURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil {
+		t.Fatal("no message received")
+	}
+
+	if err := cli.Delete(qURL, msg.ReceiptHandle); err != nil {
+		t.Error(err)
+	}
+
+	if err := cli.ExtendVisibility(qURL, msg.ReceiptHandle, 0); err == nil {
+		t.Error("the deleted message should not be able to change visibility")
+	}
+}
+
+func TestDeleteBatch(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qURL, err := createQueueForTest(t, cli, "test-queue7.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := enqueueForTest(t, cli, qURL, "test-queue7.fifo", fmt.Sprintf("Hello%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err := cli.Receive(qURL, &ReceiveOptions{MaxMessages: MaxReceiveSize, WaitTime: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("want=%d, got=%d", 3, len(msgs))
+	}
+
+	handles := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		handles = append(handles, msg.ReceiptHandle)
+	}
+
+	if err := cli.Delete(qURL, handles...); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeletePartially(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := cli.cli.CreateQueue(context.TODO(), &sqs.CreateQueueInput{QueueName: aws.String("test-queue10")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qURL := aws.ToString(output.QueueUrl)
+
+	for i := 0; i < 2; i++ {
+		if err := cli.Send(qURL, &Message{Body: fmt.Sprintf("Hello%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err := cli.Receive(qURL, &ReceiveOptions{MaxMessages: MaxReceiveSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("want=%d, got=%d", 2, len(msgs))
+	}
+
+	handles := []string{msgs[0].ReceiptHandle, "", msgs[1].ReceiptHandle}
+	err = cli.Delete(qURL, handles...)
+	if diff := cmp.Diff([]string{""}, FailedReceiptHandles(err, handles)); diff != "" {
+		t.Error(diff)
+	}
+
+	if n, err := cli.CountMessages(qURL); err != nil || n != 0 {
+		t.Errorf("want=%d, got=(%d, %v)", 0, n, err)
+	}
+	if _, err := cli.cli.ChangeMessageVisibility(context.TODO(), &sqs.ChangeMessageVisibilityInput{QueueUrl: aws.String(qURL), ReceiptHandle: aws.String(msgs[0].ReceiptHandle)}); err == nil {
+		t.Error("the deleted message should not exist")
+	}
+}
+
+func TestDeleteOverBatchSize(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := cli.cli.CreateQueue(context.TODO(), &sqs.CreateQueueInput{QueueName: aws.String("test-queue9")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qURL := aws.ToString(output.QueueUrl)
+
+	for i := 0; i < MaxReceiveSize+2; i++ {
+		if err := cli.Send(qURL, &Message{Body: fmt.Sprintf("Hello%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handles := make([]string, 0, MaxReceiveSize+2)
+	for len(handles) < MaxReceiveSize+2 {
+		msgs, err := cli.Receive(qURL, &ReceiveOptions{MaxMessages: MaxReceiveSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) == 0 {
+			t.Fatalf("want=%d, got=%d", MaxReceiveSize+2, len(handles))
+		}
+		for _, msg := range msgs {
+			handles = append(handles, msg.ReceiptHandle)
+		}
+	}
+
+	if err := cli.Delete(qURL, handles...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Delete(qURL, handles[0], handles[1]); err != nil {
+		t.Errorf("stale receipt handles should be ignored: %v", err)
+	}
+}
+
+func TestNormalizeReceiveOptions(t *testing.T) {
+	cases := []struct {
+		opts *ReceiveOptions
+		size int
+		wait time.Duration
+	}{
+		{opts: nil, size: 1, wait: 0},
+		{opts: &ReceiveOptions{}, size: 1, wait: 0},
+		{opts: &ReceiveOptions{MaxMessages: 5, WaitTime: 3 * time.Second}, size: 5, wait: 3 * time.Second},
+		{opts: &ReceiveOptions{MaxMessages: 11, WaitTime: 21 * time.Second}, size: MaxReceiveSize, wait: MaxWaitTime},
+		{opts: &ReceiveOptions{MaxMessages: -1, WaitTime: -1}, size: 1, wait: 0},
+	}
+
+	for n, c := range cases {
+		size, wait := normalizeReceiveOptions(c.opts)
+		if size != c.size || wait != c.wait {
+			t.Errorf("%d: want=(%d, %s), got=(%d, %s)", n, c.size, c.wait, size, wait)
+		}
+	}
+}
+
+func TestExtendVisibility(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qURL, err := createQueueForTest(t, cli, "test-queue5.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enqueueForTest(t, cli, qURL, "test-queue5.fifo", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := receiveOneForTest(t, cli, qURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil {
+		t.Fatal("no message received")
+	}
+
+	if err := cli.ExtendVisibility(qURL, msg.ReceiptHandle, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := receiveOneForTest(t, cli, qURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == nil || again.Body != msg.Body {
+		t.Fatalf("want=%s, got=%v", msg.Body, again)
+	}
+	if again.ReceiveCount != 2 {
+		t.Errorf("receive count: want=%d, got=%d", 2, again.ReceiveCount)
+	}
+}
+
+func TestSend(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qURL, err := createQueueForTest(t, cli, "test-queue6.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Message{ID: "test-message-id", Body: "Hello", Attributes: map[string]string{"JobName": "foo", "Empty": ""}}
+	if err := cli.Send(qURL, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := receiveOneForTest(t, cli, qURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Body != want.Body {
+		t.Fatalf("want=%s, got=%v", want.Body, got)
+	}
+	if diff := cmp.Diff(map[string]string{"JobName": "foo"}, got.Attributes); diff != "" {
+		t.Error(diff)
+	}
+	if got.GroupID != want.ID {
+		t.Errorf("want=%s, got=%s", want.ID, got.GroupID)
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+	cli, err := NewSQSClient(testRegion, testEndpointURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qURL, err := createQueueForTest(t, cli, "test-queue8.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := enqueueForTest(t, cli, qURL, "test-queue8.fifo", fmt.Sprintf("Hello%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := cli.CountMessages(qURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Errorf("want=%d, got=%d", 2, got)
+	}
+}
+
+func TestConvertMessage(t *testing.T) {
+	in := types.Message{
+		MessageId:     aws.String("id"),
+		Body:          aws.String("Hello"),
+		ReceiptHandle: aws.String("handle"),
+		Attributes: map[string]string{
+			"SentTimestamp":           "1634515200123",
+			"ApproximateReceiveCount": "3",
+			"MessageGroupId":          "group",
+			"MessageDeduplicationId":  "dedup",
+		},
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"TraceID": {DataType: aws.String("String"), StringValue: aws.String("abc")},
+			"Count":   {DataType: aws.String("Number"), StringValue: aws.String("1")},
+			"Blob":    {DataType: aws.String("Binary"), BinaryValue: []byte{0x00}},
+		},
+	}
+
+	want := &Message{
+		ID:              "id",
+		Body:            "Hello",
+		ReceiptHandle:   "handle",
+		SentTimestamp:   time.Unix(1634515200, 123*int64(time.Millisecond)),
+		ReceiveCount:    3,
+		GroupID:         "group",
+		DeduplicationID: "dedup",
+		Attributes:      map[string]string{"TraceID": "abc", "Count": "1"},
+	}
+
+	if diff := cmp.Diff(want, convertMessage(&in)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func receiveOneForTest(t *testing.T, s *SQSClient, queueURL string) (*Message, error) {
+	t.Helper()
+
+	msgs, err := s.Receive(queueURL, nil)
+	if err != nil || len(msgs) == 0 {
+		return nil, err
+	}
+
+	return msgs[0], nil
+}
+
 func createQueueForTest(t *testing.T, s *SQSClient, key string) (string, error) {
 	t.Helper()
 
@@ -0,0 +1,197 @@
+package sqstest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type response struct {
+	XMLName   xml.Name
+	Xmlns     string      `xml:"xmlns,attr"`
+	Result    interface{} `xml:",omitempty"`
+	RequestID string      `xml:"ResponseMetadata>RequestId"`
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type attribute struct {
+	Name  string
+	Value string
+}
+
+type messageAttributeValue struct {
+	DataType    string
+	StringValue string `xml:",omitempty"`
+	BinaryValue string `xml:",omitempty"`
+}
+
+type messageAttribute struct {
+	Name  string
+	Value messageAttributeValue
+}
+
+type receivedMessage struct {
+	MessageID         string `xml:"MessageId"`
+	ReceiptHandle     string
+	MD5OfBody         string
+	Body              string
+	Attributes        []attribute        `xml:"Attribute"`
+	MessageAttributes []messageAttribute `xml:"MessageAttribute"`
+}
+
+type createQueueResult struct {
+	XMLName  xml.Name `xml:"CreateQueueResult"`
+	QueueURL string   `xml:"QueueUrl"`
+}
+
+type getQueueURLResult struct {
+	XMLName  xml.Name `xml:"GetQueueUrlResult"`
+	QueueURL string   `xml:"QueueUrl"`
+}
+
+type getQueueAttributesResult struct {
+	XMLName    xml.Name    `xml:"GetQueueAttributesResult"`
+	Attributes []attribute `xml:"Attribute"`
+}
+
+type sendMessageResult struct {
+	XMLName          xml.Name `xml:"SendMessageResult"`
+	MessageID        string   `xml:"MessageId"`
+	MD5OfMessageBody string
+	SequenceNumber   string `xml:",omitempty"`
+}
+
+type sendMessageBatchResultEntry struct {
+	ID               string `xml:"Id"`
+	MessageID        string `xml:"MessageId"`
+	MD5OfMessageBody string
+	SequenceNumber   string `xml:",omitempty"`
+}
+
+type sendMessageBatchResult struct {
+	XMLName    xml.Name                      `xml:"SendMessageBatchResult"`
+	Successful []sendMessageBatchResultEntry `xml:"SendMessageBatchResultEntry"`
+	Failed     []batchResultErrorEntry       `xml:"BatchResultErrorEntry"`
+}
+
+type receiveMessageResult struct {
+	XMLName  xml.Name          `xml:"ReceiveMessageResult"`
+	Messages []receivedMessage `xml:"Message"`
+}
+
+type batchResultEntry struct {
+	ID string `xml:"Id"`
+}
+
+type batchResultErrorEntry struct {
+	ID          string `xml:"Id"`
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+type deleteMessageBatchResult struct {
+	XMLName    xml.Name                `xml:"DeleteMessageBatchResult"`
+	Successful []batchResultEntry      `xml:"DeleteMessageBatchResultEntry"`
+	Failed     []batchResultErrorEntry `xml:"BatchResultErrorEntry"`
+}
+
+type changeMessageVisibilityBatchResult struct {
+	XMLName    xml.Name                `xml:"ChangeMessageVisibilityBatchResult"`
+	Successful []batchResultEntry      `xml:"ChangeMessageVisibilityBatchResultEntry"`
+	Failed     []batchResultErrorEntry `xml:"BatchResultErrorEntry"`
+}
+
+func (s *Server) writeResult(w http.ResponseWriter, action string, result interface{}) {
+	s.mu.Lock()
+	id := s.nextID()
+	s.mu.Unlock()
+
+	res := response{XMLName: xml.Name{Local: action + "Response"}, Xmlns: xmlns, Result: result, RequestID: id}
+	writeXML(w, http.StatusOK, &res)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err *apiError) {
+	s.mu.Lock()
+	id := s.nextID()
+	s.mu.Unlock()
+
+	res := errorResponse{Type: "Sender", Code: err.code, Message: err.message, RequestID: id}
+	writeXML(w, http.StatusBadRequest, &res)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+// The query protocol flattens lists into prefix.1, prefix.2 and so on.
+func indexed(form url.Values, prefix string) []string {
+	values := make([]string, 0)
+	for i := 1; ; i++ {
+		v, ok := form[fmt.Sprintf("%s.%d", prefix, i)]
+		if !ok || len(v) == 0 {
+			return values
+		}
+		values = append(values, v[0])
+	}
+}
+
+// The query protocol flattens structures in lists into prefix.1.Member, prefix.2.Member and so on.
+func entries(form url.Values, prefix string) []url.Values {
+	values := make([]url.Values, 0)
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s.%d.", prefix, i)
+		e := make(url.Values)
+		for k, v := range form {
+			if strings.HasPrefix(k, p) {
+				e[strings.TrimPrefix(k, p)] = v
+			}
+		}
+		if len(e) == 0 {
+			return values
+		}
+		values = append(values, e)
+	}
+}
+
+func batchEntries(form url.Values, prefix string) ([]url.Values, *apiError) {
+	reqs := entries(form, prefix)
+	if len(reqs) == 0 {
+		return nil, newAPIError("AWS.SimpleQueueService.EmptyBatchRequest", "There should be at least one %s in the request.", prefix)
+	}
+	if len(reqs) > maxBatchSize {
+		return nil, newAPIError("AWS.SimpleQueueService.TooManyEntriesInBatchRequest", "Maximum number of entries per request are %d. You have sent %d.", maxBatchSize, len(reqs))
+	}
+
+	ids := make(map[string]struct{}, len(reqs))
+	for _, e := range reqs {
+		id := e.Get("Id")
+		if id == "" {
+			return nil, newAPIError("AWS.SimpleQueueService.InvalidBatchEntryId", "A batch entry id can only contain alphanumeric characters, hyphens and underscores.")
+		}
+		if _, ok := ids[id]; ok {
+			return nil, newAPIError("AWS.SimpleQueueService.BatchEntryIdsNotDistinct", "Id %s repeated.", id)
+		}
+		ids[id] = struct{}{}
+	}
+
+	return reqs, nil
+}
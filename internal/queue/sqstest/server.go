@@ -0,0 +1,771 @@
+// Package sqstest provides an in-process server speaking the query protocol of AWS SQS for testing.
+package sqstest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AccountID is the account ID in queue URLs
+	AccountID = "000000000000"
+
+	xmlns                    = "http://queue.amazonaws.com/doc/2012-11-05/"
+	fifoSuffix               = ".fifo"
+	defaultVisibilityTimeout = 30
+	maxVisibilityTimeout     = 12 * 60 * 60
+	maxReceiveSize           = 10
+	maxWaitTime              = 20
+	maxBatchSize             = 10
+	deduplicationInterval    = 5 * time.Minute
+	pollingInterval          = 10 * time.Millisecond
+)
+
+// Server is
+type Server struct {
+	URL string
+
+	srv    *httptest.Server
+	queues map[string]*queue
+	seq    int
+	mu     sync.Mutex
+}
+
+type queue struct {
+	name              string
+	attributes        map[string]string
+	visibilityTimeout int
+	waitTime          int
+	fifo              bool
+	contentBasedDedup bool
+	createdAt         time.Time
+	messages          []*message
+	deduplicated      map[string]*message
+}
+
+type message struct {
+	id                string
+	body              string
+	groupID           string
+	deduplicationID   string
+	sequenceNumber    string
+	attributes        map[string]messageAttributeValue
+	sentAt            time.Time
+	firstReceivedAt   time.Time
+	receiveCount      int
+	receiptHandle     string
+	visibleAt         time.Time
+	deduplicatedUntil time.Time
+}
+
+type apiError struct {
+	code    string
+	message string
+}
+
+// NewServer is
+func NewServer() *Server {
+	s := &Server{queues: make(map[string]*queue)}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close is
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// QueueURL is
+func (s *Server) QueueURL(name string) string {
+	return s.URL + "/" + AccountID + "/" + name
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func newAPIError(code, format string, args ...interface{}) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeError(w, newAPIError("MalformedQueryString", "%v", err))
+		return
+	}
+
+	action := r.Form.Get("Action")
+	var result interface{}
+	var err *apiError
+
+	switch action {
+	case "CreateQueue":
+		result, err = s.createQueue(r.Form)
+	case "GetQueueUrl":
+		result, err = s.getQueueURL(r.Form)
+	case "DeleteQueue":
+		err = s.deleteQueue(r.Form)
+	case "PurgeQueue":
+		err = s.purgeQueue(r.Form)
+	case "GetQueueAttributes":
+		result, err = s.getQueueAttributes(r.Form)
+	case "SendMessage":
+		result, err = s.sendMessage(r.Form)
+	case "SendMessageBatch":
+		result, err = s.sendMessageBatch(r.Form)
+	case "ReceiveMessage":
+		result, err = s.receiveMessage(r)
+	case "DeleteMessage":
+		err = s.deleteMessage(r.Form)
+	case "DeleteMessageBatch":
+		result, err = s.deleteMessageBatch(r.Form)
+	case "ChangeMessageVisibility":
+		err = s.changeMessageVisibility(r.Form)
+	case "ChangeMessageVisibilityBatch":
+		result, err = s.changeMessageVisibilityBatch(r.Form)
+	default:
+		err = newAPIError("InvalidAction", "The action %s is not valid for this endpoint.", action)
+	}
+
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeResult(w, action, result)
+}
+
+func (s *Server) nextID() string {
+	s.seq++
+	sum := sha256.Sum256([]byte(strconv.Itoa(s.seq)))
+	h := hex.EncodeToString(sum[:16])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func (s *Server) createQueue(form url.Values) (interface{}, *apiError) {
+	name := form.Get("QueueName")
+	if name == "" {
+		return nil, newAPIError("MissingParameter", "The request must contain the parameter QueueName.")
+	}
+
+	attrs := make(map[string]string)
+	for _, e := range entries(form, "Attribute") {
+		attrs[e.Get("Name")] = e.Get("Value")
+	}
+
+	q, err := newQueue(name, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.queues[name]; ok {
+		for k, v := range attrs {
+			if existing.attributes[k] != v {
+				return nil, newAPIError("QueueAlreadyExists", "A queue already exists with the same name and a different value for attribute %s", k)
+			}
+		}
+	} else {
+		s.queues[name] = q
+	}
+
+	return &createQueueResult{QueueURL: s.QueueURL(name)}, nil
+}
+
+func newQueue(name string, attrs map[string]string) (*queue, *apiError) {
+	q := queue{
+		name:              name,
+		attributes:        attrs,
+		visibilityTimeout: defaultVisibilityTimeout,
+		createdAt:         time.Now(),
+		deduplicated:      make(map[string]*message),
+	}
+
+	if v, ok := attrs["VisibilityTimeout"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxVisibilityTimeout {
+			return nil, newAPIError("InvalidAttributeValue", "Invalid value for the parameter VisibilityTimeout.")
+		}
+		q.visibilityTimeout = n
+	}
+
+	if v, ok := attrs["ReceiveMessageWaitTimeSeconds"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxWaitTime {
+			return nil, newAPIError("InvalidAttributeValue", "Invalid value for the parameter ReceiveMessageWaitTimeSeconds.")
+		}
+		q.waitTime = n
+	}
+
+	q.fifo = attrs["FifoQueue"] == "true"
+	if q.fifo != strings.HasSuffix(name, fifoSuffix) {
+		return nil, newAPIError("InvalidParameterValue", "The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix.")
+	}
+
+	q.contentBasedDedup = attrs["ContentBasedDeduplication"] == "true"
+	if q.contentBasedDedup && !q.fifo {
+		return nil, newAPIError("InvalidAttributeName", "Unknown Attribute ContentBasedDeduplication.")
+	}
+
+	return &q, nil
+}
+
+func (s *Server) getQueueURL(form url.Values) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := form.Get("QueueName")
+	if _, ok := s.queues[name]; !ok {
+		return nil, errNonExistentQueue()
+	}
+
+	return &getQueueURLResult{QueueURL: s.QueueURL(name)}, nil
+}
+
+func (s *Server) deleteQueue(form url.Values) *apiError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return err
+	}
+
+	delete(s.queues, q.name)
+	return nil
+}
+
+func (s *Server) purgeQueue(form url.Values) *apiError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return err
+	}
+
+	q.messages = nil
+	return nil
+}
+
+// Queues are identified by the last path segment of URLs so that any hosts can be used.
+func (s *Server) lookUpQueue(form url.Values) (*queue, *apiError) {
+	raw := form.Get("QueueUrl")
+	if raw == "" {
+		return nil, newAPIError("MissingParameter", "The request must contain the parameter QueueUrl.")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, newAPIError("InvalidAddress", "The address %s is not valid for this endpoint.", raw)
+	}
+
+	q, ok := s.queues[path.Base(u.Path)]
+	if !ok {
+		return nil, errNonExistentQueue()
+	}
+
+	return q, nil
+}
+
+func errNonExistentQueue() *apiError {
+	return newAPIError("AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist for this wsdl version.")
+}
+
+func (s *Server) getQueueAttributes(form url.Values) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var visible, inFlight, delayed int
+	for _, m := range q.messages {
+		switch {
+		case !now.Before(m.visibleAt):
+			visible++
+		case m.receiveCount > 0:
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+
+	all := map[string]string{
+		"ApproximateNumberOfMessages":           strconv.Itoa(visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(inFlight),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"VisibilityTimeout":                     strconv.Itoa(q.visibilityTimeout),
+		"ReceiveMessageWaitTimeSeconds":         strconv.Itoa(q.waitTime),
+		"CreatedTimestamp":                      strconv.FormatInt(q.createdAt.Unix(), 10),
+		"QueueArn":                              "arn:aws:sqs:us-east-1:" + AccountID + ":" + q.name,
+	}
+	if q.fifo {
+		all["FifoQueue"] = "true"
+		all["ContentBasedDeduplication"] = strconv.FormatBool(q.contentBasedDedup)
+	}
+
+	return &getQueueAttributesResult{Attributes: selectAttributes(all, indexed(form, "AttributeName"))}, nil
+}
+
+func selectAttributes(all map[string]string, names []string) []attribute {
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[name] = struct{}{}
+	}
+	_, everything := wanted["All"]
+
+	attrs := make([]attribute, 0, len(all))
+	for k, v := range all {
+		if _, ok := wanted[k]; ok || everything {
+			attrs = append(attrs, attribute{Name: k, Value: v})
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+
+	return attrs
+}
+
+func (s *Server) sendMessage(form url.Values) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.enqueue(q, form)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sendMessageResult{MessageID: m.id, MD5OfMessageBody: md5Hex(m.body), SequenceNumber: m.sequenceNumber}, nil
+}
+
+func (s *Server) sendMessageBatch(form url.Values) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs, err := batchEntries(form, "SendMessageBatchRequestEntry")
+	if err != nil {
+		return nil, err
+	}
+
+	var result sendMessageBatchResult
+	for _, e := range reqs {
+		m, err := s.enqueue(q, e)
+		if err != nil {
+			result.Failed = append(result.Failed, newBatchResultErrorEntry(e.Get("Id"), err))
+			continue
+		}
+
+		result.Successful = append(result.Successful, sendMessageBatchResultEntry{
+			ID:               e.Get("Id"),
+			MessageID:        m.id,
+			MD5OfMessageBody: md5Hex(m.body),
+			SequenceNumber:   m.sequenceNumber,
+		})
+	}
+
+	return &result, nil
+}
+
+func (s *Server) enqueue(q *queue, form url.Values) (*message, *apiError) {
+	body := form.Get("MessageBody")
+	if body == "" {
+		return nil, newAPIError("MissingParameter", "The request must contain the parameter MessageBody.")
+	}
+
+	now := time.Now()
+	m := message{
+		body:            body,
+		groupID:         form.Get("MessageGroupId"),
+		deduplicationID: form.Get("MessageDeduplicationId"),
+		sentAt:          now,
+		visibleAt:       now,
+	}
+
+	if v := form.Get("DelaySeconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 900 {
+			return nil, newAPIError("InvalidParameterValue", "Value %s for parameter DelaySeconds is invalid.", v)
+		}
+		if q.fifo && n > 0 {
+			return nil, newAPIError("InvalidParameterValue", "Value %s for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", v)
+		}
+		m.visibleAt = now.Add(time.Duration(n) * time.Second)
+	}
+
+	for _, e := range entries(form, "MessageAttribute") {
+		v := messageAttributeValue{DataType: e.Get("Value.DataType"), StringValue: e.Get("Value.StringValue"), BinaryValue: e.Get("Value.BinaryValue")}
+		if v.DataType == "" || (v.StringValue == "" && v.BinaryValue == "") {
+			return nil, newAPIError("InvalidParameterValue", "Message (user) attribute '%s' must contain a non-empty value of type '%s'.", e.Get("Name"), v.DataType)
+		}
+		if m.attributes == nil {
+			m.attributes = make(map[string]messageAttributeValue)
+		}
+		m.attributes[e.Get("Name")] = v
+	}
+
+	if q.fifo {
+		if m.groupID == "" {
+			return nil, newAPIError("MissingParameter", "The request must contain the parameter MessageGroupId.")
+		}
+
+		if m.deduplicationID == "" {
+			if !q.contentBasedDedup {
+				return nil, newAPIError("InvalidParameterValue", "The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+			}
+			sum := sha256.Sum256([]byte(body))
+			m.deduplicationID = hex.EncodeToString(sum[:])
+		}
+
+		// A duplicated message is accepted but not delivered.
+		if prev, ok := q.deduplicated[m.deduplicationID]; ok && now.Before(prev.deduplicatedUntil) {
+			return prev, nil
+		}
+		m.deduplicatedUntil = now.Add(deduplicationInterval)
+		q.deduplicated[m.deduplicationID] = &m
+
+		s.seq++
+		m.sequenceNumber = fmt.Sprintf("%020d", s.seq)
+	} else if m.groupID != "" || m.deduplicationID != "" {
+		return nil, newAPIError("InvalidParameterValue", "The request include parameter that is not valid for this queue type")
+	}
+
+	m.id = s.nextID()
+	q.messages = append(q.messages, &m)
+
+	return &m, nil
+}
+
+func (s *Server) receiveMessage(r *http.Request) (interface{}, *apiError) {
+	size, visibility, wait, err := s.parseReceiveParams(r.Form)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		msgs, err := s.dequeue(r.Form, size, visibility)
+		if err != nil || len(msgs) > 0 || !time.Now().Before(deadline) {
+			return &receiveMessageResult{Messages: msgs}, err
+		}
+
+		select {
+		case <-r.Context().Done():
+			return &receiveMessageResult{}, nil
+		case <-time.After(pollingInterval):
+		}
+	}
+}
+
+func (s *Server) parseReceiveParams(form url.Values) (int, *int, time.Duration, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	size := 1
+	if v := form.Get("MaxNumberOfMessages"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxReceiveSize {
+			return 0, nil, 0, newAPIError("InvalidParameterValue", "Value %s for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and 10, if provided.", v)
+		}
+		size = n
+	}
+
+	var visibility *int
+	if v := form.Get("VisibilityTimeout"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxVisibilityTimeout {
+			return 0, nil, 0, newAPIError("InvalidParameterValue", "Value %s for parameter VisibilityTimeout is invalid.", v)
+		}
+		visibility = &n
+	}
+
+	wait := q.waitTime
+	if v := form.Get("WaitTimeSeconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxWaitTime {
+			return 0, nil, 0, newAPIError("InvalidParameterValue", "Value %s for parameter WaitTimeSeconds is invalid. Reason: Must be >= 0 and <= 20, if provided.", v)
+		}
+		wait = n
+	}
+
+	return size, visibility, time.Duration(wait) * time.Second, nil
+}
+
+func (s *Server) dequeue(form url.Values, size int, visibility *int) ([]receivedMessage, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := q.visibilityTimeout
+	if visibility != nil {
+		timeout = *visibility
+	}
+
+	now := time.Now()
+
+	// Messages in a group are delivered in order, so that the group is blocked while any of them is in flight.
+	blocked := make(map[string]struct{})
+	if q.fifo {
+		for _, m := range q.messages {
+			if m.receiveCount > 0 && now.Before(m.visibleAt) {
+				blocked[m.groupID] = struct{}{}
+			}
+		}
+	}
+
+	attrNames := indexed(form, "AttributeName")
+	msgAttrNames := indexed(form, "MessageAttributeName")
+
+	msgs := make([]receivedMessage, 0, size)
+	for _, m := range q.messages {
+		if len(msgs) == size {
+			break
+		}
+
+		if now.Before(m.visibleAt) {
+			continue
+		}
+
+		if _, ok := blocked[m.groupID]; ok && q.fifo {
+			continue
+		}
+
+		if m.receiveCount == 0 {
+			m.firstReceivedAt = now
+		}
+		m.receiveCount++
+		m.receiptHandle = s.nextID()
+		m.visibleAt = now.Add(time.Duration(timeout) * time.Second)
+
+		msgs = append(msgs, receivedMessage{
+			MessageID:         m.id,
+			ReceiptHandle:     m.receiptHandle,
+			MD5OfBody:         md5Hex(m.body),
+			Body:              m.body,
+			Attributes:        selectAttributes(m.systemAttributes(), attrNames),
+			MessageAttributes: m.selectMessageAttributes(msgAttrNames),
+		})
+	}
+
+	return msgs, nil
+}
+
+func (m *message) systemAttributes() map[string]string {
+	attrs := map[string]string{
+		"SenderId":                         AccountID,
+		"SentTimestamp":                    strconv.FormatInt(m.sentAt.UnixNano()/int64(time.Millisecond), 10),
+		"ApproximateReceiveCount":          strconv.Itoa(m.receiveCount),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceivedAt.UnixNano()/int64(time.Millisecond), 10),
+	}
+
+	if m.groupID != "" {
+		attrs["MessageGroupId"] = m.groupID
+		attrs["MessageDeduplicationId"] = m.deduplicationID
+		attrs["SequenceNumber"] = m.sequenceNumber
+	}
+
+	return attrs
+}
+
+func (m *message) selectMessageAttributes(names []string) []messageAttribute {
+	attrs := make([]messageAttribute, 0, len(m.attributes))
+	for k, v := range m.attributes {
+		for _, name := range names {
+			if name == "All" || name == ".*" || name == k || (strings.HasSuffix(name, ".*") && strings.HasPrefix(k, strings.TrimSuffix(name, "*"))) {
+				attrs = append(attrs, messageAttribute{Name: k, Value: v})
+				break
+			}
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+
+	return attrs
+}
+
+func (s *Server) deleteMessage(form url.Values) *apiError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return err
+	}
+
+	return q.delete(form.Get("ReceiptHandle"))
+}
+
+func (s *Server) deleteMessageBatch(form url.Values) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs, err := batchEntries(form, "DeleteMessageBatchRequestEntry")
+	if err != nil {
+		return nil, err
+	}
+
+	var result deleteMessageBatchResult
+	for _, e := range reqs {
+		if err := q.delete(e.Get("ReceiptHandle")); err != nil {
+			result.Failed = append(result.Failed, newBatchResultErrorEntry(e.Get("Id"), err))
+			continue
+		}
+		result.Successful = append(result.Successful, batchResultEntry{ID: e.Get("Id")})
+	}
+
+	return &result, nil
+}
+
+func (s *Server) changeMessageVisibility(form url.Values) *apiError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return err
+	}
+
+	return q.changeVisibility(form.Get("ReceiptHandle"), form.Get("VisibilityTimeout"))
+}
+
+func (s *Server) changeMessageVisibilityBatch(form url.Values) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookUpQueue(form)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs, err := batchEntries(form, "ChangeMessageVisibilityBatchRequestEntry")
+	if err != nil {
+		return nil, err
+	}
+
+	var result changeMessageVisibilityBatchResult
+	for _, e := range reqs {
+		if err := q.changeVisibility(e.Get("ReceiptHandle"), e.Get("VisibilityTimeout")); err != nil {
+			result.Failed = append(result.Failed, newBatchResultErrorEntry(e.Get("Id"), err))
+			continue
+		}
+		result.Successful = append(result.Successful, batchResultEntry{ID: e.Get("Id")})
+	}
+
+	return &result, nil
+}
+
+// A receipt handle is only valid until the message is received again.
+func (q *queue) indexOf(receiptHandle string) (int, *apiError) {
+	if receiptHandle == "" {
+		return -1, newAPIError("MissingParameter", "The request must contain the parameter ReceiptHandle.")
+	}
+
+	for i, m := range q.messages {
+		if m.receiptHandle == receiptHandle {
+			return i, nil
+		}
+	}
+
+	return -1, newAPIError("ReceiptHandleIsInvalid", "The input receipt handle \"%s\" is not a valid receipt handle.", receiptHandle)
+}
+
+// Well-formed but stale handles are accepted as SQS does since the message might have been deleted or received again.
+func (q *queue) delete(receiptHandle string) *apiError {
+	i, err := q.indexOf(receiptHandle)
+	if err != nil {
+		if err.code == "ReceiptHandleIsInvalid" && isWellFormed(receiptHandle) {
+			return nil
+		}
+		return err
+	}
+
+	q.messages = append(q.messages[:i], q.messages[i+1:]...)
+	return nil
+}
+
+// Receipt handles are formatted as the message IDs.
+func isWellFormed(receiptHandle string) bool {
+	parts := strings.Split(receiptHandle, "-")
+	if len(parts) != 5 {
+		return false
+	}
+
+	for i, n := range []int{8, 4, 4, 4, 12} {
+		if len(parts[i]) != n {
+			return false
+		}
+		if _, err := hex.DecodeString(parts[i]); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (q *queue) changeVisibility(receiptHandle, timeout string) *apiError {
+	i, err := q.indexOf(receiptHandle)
+	if err != nil {
+		return err
+	}
+
+	n, e := strconv.Atoi(timeout)
+	if e != nil || n < 0 || n > maxVisibilityTimeout {
+		return newAPIError("InvalidParameterValue", "Value %s for parameter VisibilityTimeout is invalid.", timeout)
+	}
+
+	m := q.messages[i]
+	if !time.Now().Before(m.visibleAt) {
+		return newAPIError("AWS.SimpleQueueService.MessageNotInflight", "Message does not exist or is not available for visibility timeout change.")
+	}
+	m.visibleAt = time.Now().Add(time.Duration(n) * time.Second)
+
+	return nil
+}
+
+func newBatchResultErrorEntry(id string, err *apiError) batchResultErrorEntry {
+	return batchResultErrorEntry{ID: id, Code: err.code, Message: err.message, SenderFault: true}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,249 @@
+package sqstest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	testServer *Server
+	testClient *sqs.Client
+)
+
+func TestMain(m *testing.M) {
+	testServer = NewServer()
+	testClient = sqs.New(sqs.Options{
+		Region:      "ap-northeast-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AAAAAAAAAAAAAAAAAAAA", "0000000000000000000000000000000000000000", ""),
+		EndpointResolver: sqs.EndpointResolverFunc(func(region string, _ sqs.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: testServer.URL, SigningRegion: region}, nil
+		}),
+	})
+
+	code := m.Run()
+	testServer.Close()
+	os.Exit(code)
+}
+
+func TestCreateQueue(t *testing.T) {
+	cases := []struct {
+		name  string
+		attrs map[string]string
+		code  string
+	}{
+		{name: "standard", attrs: nil, code: ""},
+		{name: "standard", attrs: nil, code: ""},
+		{name: "standard", attrs: map[string]string{"VisibilityTimeout": "10"}, code: "QueueAlreadyExists"},
+		{name: "fifo.fifo", attrs: map[string]string{"FifoQueue": "true"}, code: ""},
+		{name: "fifo", attrs: map[string]string{"FifoQueue": "true"}, code: "InvalidParameterValue"},
+		{name: "dedup", attrs: map[string]string{"ContentBasedDeduplication": "true"}, code: "InvalidAttributeName"},
+	}
+
+	for n, c := range cases {
+		output, err := testClient.CreateQueue(context.TODO(), &sqs.CreateQueueInput{QueueName: aws.String(c.name), Attributes: c.attrs})
+		if got := errorCode(err); got != c.code {
+			t.Errorf("%d: want=%q, got=%q", n, c.code, got)
+			continue
+		}
+		if err == nil && aws.ToString(output.QueueUrl) != testServer.QueueURL(c.name) {
+			t.Errorf("%d: want=%s, got=%s", n, testServer.QueueURL(c.name), aws.ToString(output.QueueUrl))
+		}
+	}
+}
+
+func TestNonExistentQueue(t *testing.T) {
+	_, err := testClient.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: aws.String(testServer.QueueURL("nothing"))})
+	if got := errorCode(err); got != "AWS.SimpleQueueService.NonExistentQueue" {
+		t.Errorf("want=%s, got=%q", "AWS.SimpleQueueService.NonExistentQueue", got)
+	}
+}
+
+func TestFIFOQueue(t *testing.T) {
+	qURL := createQueueForTest(t, "test-fifo.fifo", map[string]string{"FifoQueue": "true", "ContentBasedDeduplication": "true"})
+
+	entries := []types.SendMessageBatchRequestEntry{
+		{Id: aws.String("1"), MessageBody: aws.String("a1"), MessageGroupId: aws.String("a")},
+		{Id: aws.String("2"), MessageBody: aws.String("a2"), MessageGroupId: aws.String("a")},
+		{Id: aws.String("3"), MessageBody: aws.String("b1"), MessageGroupId: aws.String("b")},
+		{Id: aws.String("4"), MessageBody: aws.String("b1"), MessageGroupId: aws.String("b")},
+		{Id: aws.String("5"), MessageBody: aws.String("no group")},
+	}
+	output, err := testClient.SendMessageBatch(context.TODO(), &sqs.SendMessageBatchInput{QueueUrl: aws.String(qURL), Entries: entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Successful) != 4 || len(output.Failed) != 1 || aws.ToString(output.Failed[0].Id) != "5" {
+		t.Fatalf("unexpected result: successful=%d, failed=%d", len(output.Successful), len(output.Failed))
+	}
+	if aws.ToString(output.Successful[2].MessageId) != aws.ToString(output.Successful[3].MessageId) {
+		t.Error("duplicated message should have the same message ID")
+	}
+
+	// Messages in flight block the following ones of the same group.
+	steps := []struct {
+		max    int32
+		bodies []string
+	}{
+		{1, []string{"a1"}},
+		{10, []string{"b1"}},
+		{10, []string{}},
+	}
+
+	var first string
+	for i, step := range steps {
+		msgs := receiveForTest(t, qURL, step.max)
+		if len(msgs) != len(step.bodies) {
+			t.Fatalf("%d: want=%v, got=%d messages", i, step.bodies, len(msgs))
+		}
+		for j, msg := range msgs {
+			if aws.ToString(msg.Body) != step.bodies[j] {
+				t.Errorf("%d: %d: want=%s, got=%s", i, j, step.bodies[j], aws.ToString(msg.Body))
+			}
+		}
+		if i == 0 {
+			first = aws.ToString(msgs[0].ReceiptHandle)
+		}
+	}
+
+	if _, err := testClient.ChangeMessageVisibility(context.TODO(), &sqs.ChangeMessageVisibilityInput{QueueUrl: aws.String(qURL), ReceiptHandle: aws.String(first)}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := receiveForTest(t, qURL, 10)
+	if len(msgs) != 2 || aws.ToString(msgs[0].Body) != "a1" || msgs[0].Attributes["ApproximateReceiveCount"] != "2" {
+		t.Errorf("released message should be redelivered in order: %+v", msgs)
+	}
+}
+
+func TestBatchRequests(t *testing.T) {
+	qURL := createQueueForTest(t, "test-batch", nil)
+
+	for _, body := range []string{"foo", "bar"} {
+		if _, err := testClient.SendMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: aws.String(qURL), MessageBody: aws.String(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := receiveForTest(t, qURL, 10)
+	if len(msgs) != 2 {
+		t.Fatalf("want=%d, got=%d", 2, len(msgs))
+	}
+
+	changed, err := testClient.ChangeMessageVisibilityBatch(context.TODO(), &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(qURL),
+		Entries: []types.ChangeMessageVisibilityBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: msgs[0].ReceiptHandle, VisibilityTimeout: 60},
+			{Id: aws.String("1"), ReceiptHandle: aws.String("invalid"), VisibilityTimeout: 60},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed.Successful) != 1 || len(changed.Failed) != 1 || aws.ToString(changed.Failed[0].Code) != "ReceiptHandleIsInvalid" {
+		t.Errorf("unexpected result: successful=%d, failed=%d", len(changed.Successful), len(changed.Failed))
+	}
+
+	deleted, err := testClient.DeleteMessageBatch(context.TODO(), &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(qURL),
+		Entries: []types.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: msgs[0].ReceiptHandle},
+			{Id: aws.String("1"), ReceiptHandle: msgs[1].ReceiptHandle},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted.Successful) != 2 || len(deleted.Failed) != 0 {
+		t.Errorf("unexpected result: successful=%d, failed=%d", len(deleted.Successful), len(deleted.Failed))
+	}
+
+	if _, err := testClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{QueueUrl: aws.String(qURL), ReceiptHandle: msgs[0].ReceiptHandle}); err != nil {
+		t.Errorf("stale receipt handle should be ignored: %v", err)
+	}
+	_, err = testClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{QueueUrl: aws.String(qURL), ReceiptHandle: aws.String("invalid")})
+	if got := errorCode(err); got != "ReceiptHandleIsInvalid" {
+		t.Errorf("want=%s, got=%s", "ReceiptHandleIsInvalid", got)
+	}
+
+	_, err = testClient.DeleteMessageBatch(context.TODO(), &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(qURL),
+		Entries: []types.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: msgs[0].ReceiptHandle},
+			{Id: aws.String("0"), ReceiptHandle: msgs[1].ReceiptHandle},
+		},
+	})
+	if got := errorCode(err); got != "AWS.SimpleQueueService.BatchEntryIdsNotDistinct" {
+		t.Errorf("want=%s, got=%q", "AWS.SimpleQueueService.BatchEntryIdsNotDistinct", got)
+	}
+}
+
+func TestGetQueueAttributes(t *testing.T) {
+	qURL := createQueueForTest(t, "test-attributes", nil)
+
+	for i, delay := range []int32{0, 0, 900} {
+		if _, err := testClient.SendMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: aws.String(qURL), MessageBody: aws.String("Hello"), DelaySeconds: delay}); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	receiveForTest(t, qURL, 1)
+
+	output, err := testClient.GetQueueAttributes(context.TODO(), &sqs.GetQueueAttributesInput{QueueUrl: aws.String(qURL), AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"ApproximateNumberOfMessages":           "1",
+		"ApproximateNumberOfMessagesNotVisible": "1",
+		"ApproximateNumberOfMessagesDelayed":    "1",
+		"VisibilityTimeout":                     "30",
+	}
+	for k, v := range want {
+		if got := output.Attributes[k]; got != v {
+			t.Errorf("%s: want=%s, got=%s", k, v, got)
+		}
+	}
+}
+
+func createQueueForTest(t *testing.T, name string, attrs map[string]string) string {
+	t.Helper()
+
+	output, err := testClient.CreateQueue(context.TODO(), &sqs.CreateQueueInput{QueueName: aws.String(name), Attributes: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return aws.ToString(output.QueueUrl)
+}
+
+func receiveForTest(t *testing.T, queueURL string, max int32) []types.Message {
+	t.Helper()
+
+	output, err := testClient.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: max,
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output.Messages
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	return ""
+}
@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+const (
+	// It is the same as the default of the controller.
+	defaultHistoryLimit = 10
+)
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func buildDefaultPatches(obj *customapiv1.AWSSQSWorkerJob) []patchOperation {
+	patches := make([]patchOperation, 0, 1)
+
+	if obj.Spec.HistoryLimit == nil {
+		patches = append(patches, patchOperation{Op: "add", Path: "/spec/historyLimit", Value: defaultHistoryLimit})
+	}
+
+	return patches
+}
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildDefaultPatches(t *testing.T) {
+	three := int32(3)
+
+	obj := validObjectForTest()
+	want := []patchOperation{{Op: "add", Path: "/spec/historyLimit", Value: defaultHistoryLimit}}
+	if diff := cmp.Diff(want, buildDefaultPatches(obj)); diff != "" {
+		t.Error(diff)
+	}
+
+	obj.Spec.HistoryLimit = &three
+	if got := buildDefaultPatches(obj); len(got) != 0 {
+		t.Errorf("want=%d, got=%v", 0, got)
+	}
+}
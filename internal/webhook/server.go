@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+const (
+	// ValidatingPath is
+	ValidatingPath = "/validate"
+
+	// DefaultingPath is
+	DefaultingPath = "/default"
+
+	maxRequestSize = 3 * 1024 * 1024
+)
+
+type admitFunc func(*customapiv1.AWSSQSWorkerJob) (*admissionv1.AdmissionResponse, error)
+
+// Handler is
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ValidatingPath, func(w http.ResponseWriter, r *http.Request) { serve(w, r, validate) })
+	mux.HandleFunc(DefaultingPath, func(w http.ResponseWriter, r *http.Request) { serve(w, r, mutate) })
+	return mux
+}
+
+func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("Unable to decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var obj customapiv1.AWSSQSWorkerJob
+	var resp *admissionv1.AdmissionResponse
+	if err := json.Unmarshal(review.Request.Object.Raw, &obj); err != nil {
+		resp = &admissionv1.AdmissionResponse{Result: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error(), Code: http.StatusBadRequest}}
+	} else if resp, err = admit(&obj); err != nil {
+		resp = &admissionv1.AdmissionResponse{Result: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error(), Code: http.StatusInternalServerError}}
+	}
+
+	resp.UID = review.Request.UID
+	review.Response = resp
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&review); err != nil {
+		klog.Errorf("Failed to write admission response: %v", err)
+	}
+}
+
+func validate(obj *customapiv1.AWSSQSWorkerJob) (*admissionv1.AdmissionResponse, error) {
+	errs := Validate(obj)
+	if len(errs) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}, nil
+	}
+
+	return &admissionv1.AdmissionResponse{
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: errs.ToAggregate().Error(),
+		},
+	}, nil
+}
+
+func mutate(obj *customapiv1.AWSSQSWorkerJob) (*admissionv1.AdmissionResponse, error) {
+	patches := buildDefaultPatches(obj)
+	if len(patches) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}, nil
+	}
+
+	patch, err := json.Marshal(patches)
+	if err != nil {
+		return nil, err
+	}
+
+	pt := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &pt}, nil
+}
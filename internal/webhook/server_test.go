@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+func TestHandler(t *testing.T) {
+	valid := validObjectForTest()
+	invalid := validObjectForTest()
+	invalid.Spec.QueueURL = "foo"
+
+	cases := []struct {
+		path    string
+		obj     *customapiv1.AWSSQSWorkerJob
+		allowed bool
+		patched bool
+	}{
+		{ValidatingPath, valid, true, false},
+		{ValidatingPath, invalid, false, false},
+		{DefaultingPath, valid, true, true},
+	}
+
+	for i, c := range cases {
+		raw, err := json.Marshal(c.obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		review := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: types.UID("uid"), Object: runtime.RawExtension{Raw: raw}}}
+		body, err := json.Marshal(&review)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, c.path, bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%d: status: want=%d, got=%d", i, http.StatusOK, rec.Code)
+			continue
+		}
+
+		var got admissionv1.AdmissionReview
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Response.UID != "uid" {
+			t.Errorf("%d: uid: want=%s, got=%s", i, "uid", got.Response.UID)
+		}
+		if got.Response.Allowed != c.allowed {
+			t.Errorf("%d: allowed: want=%t, got=%t", i, c.allowed, got.Response.Allowed)
+		}
+		if patched := len(got.Response.Patch) > 0; patched != c.patched {
+			t.Errorf("%d: patched: want=%t, got=%t", i, c.patched, patched)
+		}
+	}
+}
+
+func TestHandlerWithInvalidRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ValidatingPath, bytes.NewReader([]byte("{"))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want=%d, got=%d", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+var (
+	// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-queue-message-identifiers.html
+	queuePathPattern = regexp.MustCompile(`^/[0-9]{12}/[A-Za-z0-9_-]{1,80}(\.fifo)?$`)
+)
+
+// Validate is
+func Validate(obj *customapiv1.AWSSQSWorkerJob) field.ErrorList {
+	spec := &obj.Spec
+	path := field.NewPath("spec")
+	errs := field.ErrorList{}
+
+	errs = append(errs, validateQueueURL(spec.QueueURL, path.Child("queueURL"), true)...)
+	errs = append(errs, validateQueueURL(spec.DeadLetterQueueURL, path.Child("deadLetterQueueURL"), false)...)
+
+	errs = append(errs, validateRange(spec.HistoryLimit, 0, -1, path.Child("historyLimit"))...)
+	errs = append(errs, validateRange(spec.SuccessfulJobsHistoryLimit, 0, -1, path.Child("successfulJobsHistoryLimit"))...)
+	errs = append(errs, validateRange(spec.FailedJobsHistoryLimit, 0, -1, path.Child("failedJobsHistoryLimit"))...)
+	errs = append(errs, validateRange(spec.MaxConcurrentJobs, 1, -1, path.Child("maxConcurrentJobs"))...)
+	errs = append(errs, validateRange(spec.ReceiveBatchSize, 1, queues.MaxReceiveSize, path.Child("receiveBatchSize"))...)
+	errs = append(errs, validateRange(spec.ReceiveWaitTimeSeconds, 0, int32(queues.MaxWaitTime.Seconds()), path.Child("receiveWaitTimeSeconds"))...)
+
+	if r := spec.FinishedJobsRetention; r != nil && r.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("finishedJobsRetention"), r.Duration.String(), "must be greater than 0"))
+	}
+
+	switch spec.MessageDeletionPolicy {
+	case "", customapiv1.DeleteOnReceive, customapiv1.DeleteOnJobSucceeded:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("messageDeletionPolicy"), spec.MessageDeletionPolicy,
+			[]string{string(customapiv1.DeleteOnReceive), string(customapiv1.DeleteOnJobSucceeded)}))
+	}
+
+	switch spec.MessageFormat {
+	case "", customapiv1.MessageFormatSplit, customapiv1.MessageFormatRaw, customapiv1.MessageFormatShellWords, customapiv1.MessageFormatJSON:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("messageFormat"), spec.MessageFormat,
+			[]string{string(customapiv1.MessageFormatSplit), string(customapiv1.MessageFormatRaw), string(customapiv1.MessageFormatShellWords), string(customapiv1.MessageFormatJSON)}))
+	}
+
+	if spec.MessageEnvName != "" {
+		for _, msg := range validation.IsEnvVarName(spec.MessageEnvName) {
+			errs = append(errs, field.Invalid(path.Child("messageEnvName"), spec.MessageEnvName, msg))
+		}
+	}
+
+	errs = append(errs, validateTemplateString(spec.JobNameSuffix, path.Child("jobNameSuffix"))...)
+
+	switch spec.InjectionMode {
+	case "", customapiv1.InjectReplaceArgs, customapiv1.InjectAppendArgs, customapiv1.InjectCommand:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("injectionMode"), spec.InjectionMode,
+			[]string{string(customapiv1.InjectReplaceArgs), string(customapiv1.InjectAppendArgs), string(customapiv1.InjectCommand)}))
+	}
+
+	if spec.TargetContainer != "" && !hasContainer(&spec.Template.Spec, spec.TargetContainer) {
+		errs = append(errs, field.NotFound(path.Child("targetContainer"), spec.TargetContainer))
+	}
+
+	jobPath := path.Child("jobTemplate")
+	errs = append(errs, validateRange(spec.JobTemplate.Parallelism, 1, -1, jobPath.Child("parallelism"))...)
+	errs = append(errs, validateRange(spec.JobTemplate.Completions, 1, -1, jobPath.Child("completions"))...)
+	errs = append(errs, validateRange(spec.JobTemplate.BackoffLimit, 0, -1, jobPath.Child("backoffLimit"))...)
+	errs = append(errs, validateRange(spec.JobTemplate.TTLSecondsAfterFinished, 0, -1, jobPath.Child("ttlSecondsAfterFinished"))...)
+	// Kubernetes could delete the finished jobs before the controller acknowledges their messages.
+	if ttl := spec.JobTemplate.TTLSecondsAfterFinished; ttl != nil && (spec.MessageDeletionPolicy == customapiv1.DeleteOnJobSucceeded || spec.DeadLetterQueueURL != "") {
+		errs = append(errs, field.Forbidden(jobPath.Child("ttlSecondsAfterFinished"), "must not be set with the OnJobSucceeded messageDeletionPolicy or deadLetterQueueURL"))
+	}
+	if d := spec.JobTemplate.ActiveDeadlineSeconds; d != nil && *d < 1 {
+		errs = append(errs, field.Invalid(jobPath.Child("activeDeadlineSeconds"), *d, "must be greater than or equal to 1"))
+	}
+
+	errs = append(errs, validatePodTemplate(&spec.Template, spec.RenderTemplate, path.Child("template"))...)
+
+	return errs
+}
+
+func validateQueueURL(s string, path *field.Path, required bool) field.ErrorList {
+	if s == "" {
+		if required {
+			return field.ErrorList{field.Required(path, "")}
+		}
+		return nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, s, err.Error())}
+	}
+
+	switch u.Scheme {
+	case "https", "http":
+		if u.Host == "" || !queuePathPattern.MatchString(u.Path) {
+			return field.ErrorList{field.Invalid(path, s, "must be an SQS queue URL such as https://sqs.<region>.amazonaws.com/<account-id>/<queue-name>")}
+		}
+	case "amqps", "amqp":
+		if _, _, err := queues.ParseAMQPURL(s); err != nil {
+			return field.ErrorList{field.Invalid(path, s, "must be an AMQP queue URL such as amqp://<host>:<port>/<vhost>/<queue-name>")}
+		}
+		if u.User != nil {
+			return field.ErrorList{field.Invalid(path, u.Redacted(), "must not contain credentials, use credentialsSecretRef instead")}
+		}
+	case "rediss", "redis":
+		if _, _, err := queues.ParseRedisURL(s); err != nil {
+			return field.ErrorList{field.Invalid(path, u.Redacted(), "must be a Redis stream URL such as redis://<host>:<port>/<db>/<stream>?group=<group>")}
+		}
+		if u.User != nil {
+			return field.ErrorList{field.Invalid(path, u.Redacted(), "must not contain credentials, use credentialsSecretRef instead")}
+		}
+		if required && u.Query().Get("group") == "" {
+			return field.ErrorList{field.Invalid(path, u.Redacted(), "must have the group parameter for the consumer group")}
+		}
+	default:
+		return field.ErrorList{field.NotSupported(path, u.Scheme, []string{"https", "http", "amqps", "amqp", "rediss", "redis"})}
+	}
+
+	return nil
+}
+
+// A negative max means no upper limit.
+func validateRange(v *int32, min, max int32, path *field.Path) field.ErrorList {
+	if v == nil {
+		return nil
+	}
+
+	if *v < min {
+		return field.ErrorList{field.Invalid(path, *v, fmt.Sprintf("must be greater than or equal to %d", min))}
+	}
+
+	if max >= 0 && *v > max {
+		return field.ErrorList{field.Invalid(path, *v, fmt.Sprintf("must be less than or equal to %d", max))}
+	}
+
+	return nil
+}
+
+func validatePodTemplate(tpl *corev1.PodTemplateSpec, render bool, path *field.Path) field.ErrorList {
+	containersPath := path.Child("spec", "containers")
+	if len(tpl.Spec.Containers) == 0 {
+		return field.ErrorList{field.Required(containersPath, "at least one container is required")}
+	}
+
+	if !render {
+		return nil
+	}
+
+	errs := field.ErrorList{}
+	for k, v := range tpl.Labels {
+		errs = append(errs, validateTemplateString(v, path.Child("metadata", "labels").Key(k))...)
+	}
+
+	for i, c := range tpl.Spec.Containers {
+		for j, arg := range c.Args {
+			errs = append(errs, validateTemplateString(arg, containersPath.Index(i).Child("args").Index(j))...)
+		}
+		for j, env := range c.Env {
+			errs = append(errs, validateTemplateString(env.Value, containersPath.Index(i).Child("env").Index(j).Child("value"))...)
+		}
+	}
+
+	return errs
+}
+
+func validateTemplateString(s string, path *field.Path) field.ErrorList {
+	if !strings.Contains(s, "{{") {
+		return nil
+	}
+
+	if _, err := template.New("").Parse(s); err != nil {
+		return field.ErrorList{field.Invalid(path, s, err.Error())}
+	}
+
+	return nil
+}
+
+func hasContainer(spec *corev1.PodSpec, name string) bool {
+	for _, c := range spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapi "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+const (
+	// It must be long enough compared with the cleanup duration of the controller.
+	visibilityTimeout = 60 * time.Second
+
+	attrFailureReason  = "FailureReason"
+	attrFailureMessage = "FailureMessage"
+	attrJobName        = "JobName"
+	attrAttemptCount   = "AttemptCount"
+)
+
+var (
+	annotationReceiptHandle = customapi.GroupName + "/receipt-handle"
+	annotationMessageID     = customapi.GroupName + "/message-id"
+	annotationMessageBody   = customapi.GroupName + "/message-body"
+)
+
+func (r *Reconciler) acknowledgeMessages(parent *customapiv1.AWSSQSWorkerJob, jobs []*batchv1.Job) {
+	for _, job := range jobs {
+		if !hasPendingMessage(job) || !metav1.IsControlledBy(job, parent) {
+			continue
+		}
+
+		if err := r.acknowledgeMessage(parent, job); err != nil {
+			utilruntime.HandleError(err)
+		}
+	}
+}
+
+func (r *Reconciler) acknowledgeMessage(parent *customapiv1.AWSSQSWorkerJob, job *batchv1.Job) error {
+	handle, hasHandle := job.Annotations[annotationReceiptHandle]
+	q, err := r.queueFor(parent)
+	if err != nil {
+		return err
+	}
+
+	switch getJobFinishedStatus(job) {
+	case batchv1.JobComplete:
+		if hasHandle {
+			if err := q.Delete(parent.Spec.QueueURL, handle); err != nil {
+				return fmt.Errorf("Unable to delete message of Job %s/%s: %w", job.Namespace, job.Name, err)
+			}
+			r.recorder.Eventf(parent, corev1.EventTypeNormal, "SuccessfulDeleteMessage", "Deleted message of job %s/%s", job.Namespace, job.Name)
+		}
+	case batchv1.JobFailed:
+		if _, ok := job.Annotations[annotationMessageBody]; ok && parent.Spec.DeadLetterQueueURL != "" {
+			dlq, err := r.deadLetterQueueFor(parent)
+			if err != nil {
+				return err
+			}
+
+			if err := dlq.Send(parent.Spec.DeadLetterQueueURL, buildDeadLetter(job)); err != nil {
+				return fmt.Errorf("Unable to move message of Job %s/%s to dead-letter queue: %w", job.Namespace, job.Name, err)
+			}
+			r.recorder.Eventf(parent, corev1.EventTypeWarning, "MovedToDeadLetter", "Moved message of job %s/%s to dead-letter queue", job.Namespace, job.Name)
+
+			if hasHandle {
+				if err := q.Delete(parent.Spec.QueueURL, handle); err != nil {
+					return fmt.Errorf("Unable to delete message of Job %s/%s: %w", job.Namespace, job.Name, err)
+				}
+			}
+		} else if hasHandle {
+			// The message gets visible immediately so that another job can retry it.
+			if err := q.ExtendVisibility(parent.Spec.QueueURL, handle, 0); err != nil {
+				return fmt.Errorf("Unable to release message of Job %s/%s: %w", job.Namespace, job.Name, err)
+			}
+			r.recorder.Eventf(parent, corev1.EventTypeNormal, "SuccessfulReleaseMessage", "Released message of job %s/%s", job.Namespace, job.Name)
+		}
+	default:
+		if hasHandle {
+			if err := q.ExtendVisibility(parent.Spec.QueueURL, handle, visibilityTimeout); err != nil {
+				return fmt.Errorf("Unable to extend visibility timeout of message of Job %s/%s: %w", job.Namespace, job.Name, err)
+			}
+		}
+		return nil
+	}
+
+	cpy := job.DeepCopy()
+	delete(cpy.Annotations, annotationReceiptHandle)
+	delete(cpy.Annotations, annotationMessageBody)
+	if _, err := r.client.Builtin.BatchV1().Jobs(job.Namespace).Update(context.TODO(), cpy, updOpts); err != nil {
+		return err
+	}
+
+	klog.V(4).Infof("Acknowledged message of Job %s/%s", job.Namespace, job.Name)
+	return nil
+}
+
+func buildDeadLetter(job *batchv1.Job) *queues.Message {
+	var reason, message string
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			reason, message = c.Reason, c.Message
+			break
+		}
+	}
+
+	return &queues.Message{
+		ID:   job.Annotations[annotationMessageID],
+		Body: job.Annotations[annotationMessageBody],
+		Attributes: map[string]string{
+			attrFailureReason:  reason,
+			attrFailureMessage: message,
+			attrJobName:        job.Name,
+			attrAttemptCount:   strconv.Itoa(int(job.Status.Failed)),
+		},
+	}
+}
+
+func hasPendingMessage(job *batchv1.Job) bool {
+	_, hasHandle := job.Annotations[annotationReceiptHandle]
+	_, hasBody := job.Annotations[annotationMessageBody]
+	return hasHandle || hasBody
+}
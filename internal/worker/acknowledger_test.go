@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+type recordingQueue struct {
+	messages    []*queues.Message
+	undeletable map[string]bool
+	deleted     []string
+	extended    map[string]time.Duration
+	sent        []*queues.Message
+}
+
+func (q *recordingQueue) Receive(_ string, opts *queues.ReceiveOptions) ([]*queues.Message, error) {
+	size := opts.MaxMessages
+	if size > len(q.messages) {
+		size = len(q.messages)
+	}
+
+	msgs := q.messages[:size]
+	q.messages = q.messages[size:]
+	return msgs, nil
+}
+
+func (q *recordingQueue) Delete(_ string, handles ...string) error {
+	failed := make([]string, 0)
+	for _, h := range handles {
+		if q.undeletable[h] {
+			failed = append(failed, h)
+			continue
+		}
+		q.deleted = append(q.deleted, h)
+	}
+
+	if len(failed) > 0 {
+		return &queues.DeleteError{ReceiptHandles: failed, Err: errors.New("undeletable")}
+	}
+
+	return nil
+}
+
+func (q *recordingQueue) ExtendVisibility(_, handle string, timeout time.Duration) error {
+	q.extended[handle] = timeout
+	return nil
+}
+
+func (q *recordingQueue) Send(_ string, msg *queues.Message) error {
+	q.sent = append(q.sent, msg)
+	return nil
+}
+
+func (q *recordingQueue) CountMessages(string) (int, error) {
+	return len(q.messages), nil
+}
+
+func registryForTest(q queues.MessageQueue) *queues.Registry {
+	reg := queues.NewRegistry()
+	reg.Register("http", func(string) (queues.MessageQueue, error) { return q, nil })
+	return reg
+}
+
+func TestAcknowledgeMessages(t *testing.T) {
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			QueueURL:              "http://127.0.0.1:4566/000000000000/test-queue",
+			MessageDeletionPolicy: customapiv1.DeleteOnJobSucceeded,
+		},
+	}
+
+	cases := []struct {
+		desc       string
+		deadLetter string
+		condition  batchv1.JobConditionType
+		deleted    bool
+		extended   bool
+		timeout    time.Duration
+		sent       bool
+		forgotten  bool
+	}{
+		{desc: "running job", condition: "", deleted: false, extended: true, timeout: visibilityTimeout, forgotten: false},
+		{desc: "succeeded job", condition: batchv1.JobComplete, deleted: true, extended: false, forgotten: true},
+		{desc: "failed job", condition: batchv1.JobFailed, deleted: false, extended: true, timeout: 0, forgotten: true},
+		{desc: "failed job with dead-letter queue", deadLetter: "http://127.0.0.1:4566/000000000000/test-dlq", condition: batchv1.JobFailed, deleted: true, sent: true, forgotten: true},
+		{desc: "succeeded job with dead-letter queue", deadLetter: "http://127.0.0.1:4566/000000000000/test-dlq", condition: batchv1.JobComplete, deleted: true, forgotten: true},
+	}
+
+	for n, c := range cases {
+		parent.Spec.DeadLetterQueueURL = c.deadLetter
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "child",
+				Namespace: "default",
+				Annotations: map[string]string{
+					annotationReceiptHandle: "handle",
+					annotationMessageID:     "id",
+					annotationMessageBody:   "Hello",
+				},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(parent, customGroup)},
+			},
+		}
+		if c.condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: c.condition, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}}
+			job.Status.Failed = 2
+		}
+
+		q := &recordingQueue{extended: map[string]time.Duration{}}
+		cli := kubefake.NewSimpleClientset(job)
+		r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{}, nil, record.NewFakeRecorder(10))
+		r.WithQueueRegistry(registryForTest(q))
+
+		r.acknowledgeMessages(parent, []*batchv1.Job{job})
+
+		if got := len(q.deleted) > 0; got != c.deleted {
+			t.Errorf("%d: %s: deleted: want=%t, got=%t", n, c.desc, c.deleted, got)
+		}
+
+		timeout, got := q.extended["handle"]
+		if got != c.extended {
+			t.Errorf("%d: %s: extended: want=%t, got=%t", n, c.desc, c.extended, got)
+		}
+		if got && timeout != c.timeout {
+			t.Errorf("%d: %s: timeout: want=%s, got=%s", n, c.desc, c.timeout, timeout)
+		}
+
+		if got := len(q.sent) > 0; got != c.sent {
+			t.Errorf("%d: %s: sent: want=%t, got=%t", n, c.desc, c.sent, got)
+		}
+		if c.sent {
+			want := queues.Message{
+				ID:   "id",
+				Body: "Hello",
+				Attributes: map[string]string{
+					attrFailureReason:  "BackoffLimitExceeded",
+					attrFailureMessage: "Job has reached the specified backoff limit",
+					attrJobName:        "child",
+					attrAttemptCount:   "2",
+				},
+			}
+			if diff := cmp.Diff(&want, q.sent[0]); diff != "" {
+				t.Errorf("%d: %s: dead letter: %s", n, c.desc, diff)
+			}
+		}
+
+		updated, err := cli.BatchV1().Jobs("default").Get(context.TODO(), "child", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := !hasPendingMessage(updated); got != c.forgotten {
+			t.Errorf("%d: %s: forgotten: want=%t, got=%t", n, c.desc, c.forgotten, got)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapi "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+const (
+	secretKeyUsername = "username"
+	secretKeyPassword = "password"
+
+	// The credentials secret is checked at this interval to reopen the queue when it is rotated.
+	credentialsCheckInterval = time.Minute
+)
+
+var (
+	// The secret must list the hosts which its credentials are sent to,
+	// since anyone who can create the resource could otherwise send them anywhere.
+	annotationAllowedQueueHosts = customapi.GroupName + "/allowed-queue-hosts"
+)
+
+type cachedQueue struct {
+	raw           queues.MessageQueue
+	instrumented  queues.MessageQueue
+	secretName    string
+	secretVersion string
+	checkedAt     time.Time
+}
+
+// WithQueueRegistry is
+func (r *Reconciler) WithQueueRegistry(reg *queues.Registry) {
+	r.registry = reg
+}
+
+func (r *Reconciler) queueFor(obj *customapiv1.AWSSQSWorkerJob) (queues.MessageQueue, error) {
+	return r.resolveQueue(obj, obj.Spec.QueueURL)
+}
+
+func (r *Reconciler) deadLetterQueueFor(obj *customapiv1.AWSSQSWorkerJob) (queues.MessageQueue, error) {
+	return r.resolveQueue(obj, obj.Spec.DeadLetterQueueURL)
+}
+
+// Clients are cached per resource and rebuilt when the URLs or the credentials in the spec change.
+// They are opened and closed without the lock since it may take a while to talk to the API server or the backends.
+func (r *Reconciler) resolveQueue(obj *customapiv1.AWSSQSWorkerJob, queueURL string) (queues.MessageQueue, error) {
+	key := obj.Namespace + "/" + obj.Name
+
+	r.mu.Lock()
+	cached, stale := r.lookupQueue(key, obj, queueURL)
+	recheck := cached != nil && cached.secretName != "" && time.Since(cached.checkedAt) >= credentialsCheckInterval
+	if recheck {
+		cached.checkedAt = time.Now()
+	}
+	r.mu.Unlock()
+	closeQueues(stale)
+
+	if cached != nil && !recheck {
+		return cached.instrumented, nil
+	}
+
+	// The current client keeps working if the secret is unavailable for a while.
+	if recheck {
+		secret, err := r.client.Builtin.CoreV1().Secrets(obj.Namespace).Get(context.TODO(), cached.secretName, metav1.GetOptions{})
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("Unable to check credentials for %s: %w", key, err))
+			return cached.instrumented, nil
+		}
+		if secret.ResourceVersion == cached.secretVersion {
+			return cached.instrumented, nil
+		}
+	}
+
+	// The current client is dropped since the changed secret may no longer be allowed to use.
+	q, err := r.openQueue(obj, queueURL)
+	if err != nil {
+		if cached != nil {
+			r.dropQueue(key, queueURL, cached)
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	current, stale := r.lookupQueue(key, obj, queueURL)
+	if current == cached {
+		r.queues[key][queueURL] = q
+	}
+	r.mu.Unlock()
+
+	// Another goroutine has opened the same queue in the meantime.
+	if current != cached {
+		stale[queueURL] = q
+		closeQueues(stale)
+		return current.instrumented, nil
+	}
+
+	if cached != nil {
+		stale[queueURL] = cached
+	}
+	closeQueues(stale)
+
+	klog.V(4).Infof("Opened queue %s for %s", queueURL, key)
+	return q.instrumented, nil
+}
+
+// It must be called with the lock. The stale clients removed from the cache are returned to be closed.
+func (r *Reconciler) lookupQueue(key string, obj *customapiv1.AWSSQSWorkerJob, queueURL string) (*cachedQueue, map[string]*cachedQueue) {
+	cache, ok := r.queues[key]
+	if !ok {
+		cache = make(map[string]*cachedQueue, 2)
+		r.queues[key] = cache
+	}
+
+	var secretName string
+	if ref := obj.Spec.CredentialsSecretRef; ref != nil {
+		secretName = ref.Name
+	}
+
+	stale := make(map[string]*cachedQueue)
+	for u, q := range cache {
+		if (u != obj.Spec.QueueURL && u != obj.Spec.DeadLetterQueueURL) || q.secretName != secretName {
+			stale[u] = q
+			delete(cache, u)
+		}
+	}
+
+	return cache[queueURL], stale
+}
+
+// Credentials are only given to the opener as the user info of the URL so that they are never logged.
+func (r *Reconciler) openQueue(obj *customapiv1.AWSSQSWorkerJob, queueURL string) (*cachedQueue, error) {
+	ref := obj.Spec.CredentialsSecretRef
+	if ref == nil {
+		raw, err := r.registry.Open(queueURL)
+		if err != nil {
+			return nil, err
+		}
+		return newCachedQueue(obj, raw), nil
+	}
+
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse queue URL %s: %w", queueURL, err)
+	}
+
+	secret, err := r.client.Builtin.CoreV1().Secrets(obj.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get credentials for %s/%s: %w", obj.Namespace, obj.Name, err)
+	}
+
+	if err := checkAllowedQueueHost(secret, u); err != nil {
+		return nil, fmt.Errorf("Unable to use credentials for %s/%s: %w", obj.Namespace, obj.Name, err)
+	}
+
+	username := string(secret.Data[secretKeyUsername])
+	if password, ok := secret.Data[secretKeyPassword]; ok {
+		u.User = url.UserPassword(username, string(password))
+	} else {
+		u.User = url.User(username)
+	}
+
+	raw, err := r.registry.Open(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	q := newCachedQueue(obj, raw)
+	q.secretName = ref.Name
+	q.secretVersion = secret.ResourceVersion
+	q.checkedAt = time.Now()
+
+	return q, nil
+}
+
+func checkAllowedQueueHost(secret *corev1.Secret, u *url.URL) error {
+	hosts, ok := secret.Annotations[annotationAllowedQueueHosts]
+	if !ok {
+		return fmt.Errorf("secret %s has no %s annotation", secret.Name, annotationAllowedQueueHosts)
+	}
+
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && (h == u.Host || h == u.Hostname()) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("secret %s is not allowed for host %s", secret.Name, u.Host)
+}
+
+func newCachedQueue(obj *customapiv1.AWSSQSWorkerJob, raw queues.MessageQueue) *cachedQueue {
+	return &cachedQueue{raw: raw, instrumented: metrics.NewInstrumentedQueue(raw, obj.Namespace, obj.Name)}
+}
+
+func (r *Reconciler) dropQueue(key, queueURL string, q *cachedQueue) {
+	r.mu.Lock()
+	cache := r.queues[key]
+	dropped := cache != nil && cache[queueURL] == q
+	if dropped {
+		delete(cache, queueURL)
+	}
+	r.mu.Unlock()
+
+	if dropped {
+		closeQueue(queueURL, q)
+	}
+}
+
+func (r *Reconciler) forgetQueues(key string) {
+	r.mu.Lock()
+	stale := r.queues[key]
+	delete(r.queues, key)
+	r.mu.Unlock()
+
+	closeQueues(stale)
+}
+
+func closeQueues(qs map[string]*cachedQueue) {
+	for u, q := range qs {
+		closeQueue(u, q)
+	}
+}
+
+func closeQueue(queueURL string, q *cachedQueue) {
+	c, ok := q.raw.(io.Closer)
+	if !ok {
+		return
+	}
+
+	if err := c.Close(); err != nil {
+		utilruntime.HandleError(err)
+	}
+	klog.V(4).Infof("Closed queue %s", queueURL)
+}
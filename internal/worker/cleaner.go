@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"sort"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -12,6 +13,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/klog/v2"
 
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
 	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
 )
 
@@ -22,89 +24,108 @@ const (
 var (
 	delOpts = metav1.DeleteOptions{PropagationPolicy: func(s metav1.DeletionPropagation) *metav1.DeletionPropagation { return &s }(metav1.DeletePropagationBackground)}
 	updOpts = metav1.UpdateOptions{}
+	patOpts = metav1.PatchOptions{}
 )
 
-// Clean is
-func (r *Reconciler) Clean() {
-	parents, err := r.lister.CustomResource.List(labels.Everything())
+func (r *Reconciler) clean(parent *customapiv1.AWSSQSWorkerJob) error {
+	jobs, err := r.lister.Job.Jobs(parent.Namespace).List(labels.Everything())
 	if err != nil {
-		if !kubeerrors.IsNotFound(err) {
-			utilruntime.HandleError(err)
+		if kubeerrors.IsNotFound(err) {
+			return nil
 		}
-		return
+		return err
 	}
 
-	allJobs, err := r.lister.Job.List(labels.Everything())
-	if err != nil {
-		if !kubeerrors.IsNotFound(err) {
-			utilruntime.HandleError(err)
-		}
-		return
-	}
+	sort.Sort(JobsOrderedByStartTimeASC(jobs))
 
-	sort.Sort(JobsOrderedByStartTimeASC(allJobs))
+	r.acknowledgeMessages(parent, jobs)
 
-	var historyLimit int
-	for _, parent := range parents {
-		historyLimit = defaultHistoryLimit
-		if parent.Spec.HistoryLimit != nil {
-			historyLimit = int(*parent.Spec.HistoryLimit)
-		}
+	succeeded, failed := extractChildren(parent, jobs)
+	sort.Sort(JobsOrderedByCompletionTimeASC(succeeded))
+	sort.Sort(JobsOrderedByCompletionTimeASC(failed))
 
-		children := extractChildren(parent, allJobs, historyLimit+4)
-		size := len(children)
+	limits := getHistoryLimits(&parent.Spec)
+	now := time.Now()
 
-		if size == 0 {
-			continue
-		}
+	r.deleteChildren(parent, succeeded, countDeletable(succeeded, limits.succeeded, parent.Spec.FinishedJobsRetention, now))
+	r.deleteChildren(parent, failed, countDeletable(failed, limits.failed, parent.Spec.FinishedJobsRetention, now))
+
+	return nil
+}
 
-		if err := r.updateParent(parent, children[size-1]); err != nil {
+func (r *Reconciler) deleteChildren(parent *customapiv1.AWSSQSWorkerJob, children []*batchv1.Job, n int) {
+	for _, child := range children[0:n] {
+		if err := r.client.Builtin.BatchV1().Jobs(parent.Namespace).Delete(context.TODO(), child.Name, delOpts); err != nil {
 			utilruntime.HandleError(err)
 			continue
 		}
 
-		if size <= historyLimit {
-			continue
-		}
+		metrics.JobsDeleted.WithLabelValues(parent.Namespace, parent.Name).Inc()
+		r.recorder.Eventf(parent, corev1.EventTypeNormal, "SuccessfulDelete", "Deleted job %s/%s", child.Namespace, child.Name)
+		klog.V(4).Infof("Deleted resource %s/%s successfully", child.Namespace, child.Name)
+	}
+}
+
+// The children must be sorted by completion time so that the deletable ones come first.
+func countDeletable(children []*batchv1.Job, limit int, retention *metav1.Duration, now time.Time) int {
+	n := 0
+	if len(children) > limit {
+		n = len(children) - limit
+	}
 
-		for _, child := range children[0 : size-historyLimit] {
-			if err := r.client.Builtin.BatchV1().Jobs(parent.Namespace).Delete(context.TODO(), child.Name, delOpts); err != nil {
-				utilruntime.HandleError(err)
-				continue
-			}
+	if retention == nil {
+		return n
+	}
 
-			r.recorder.Eventf(parent, corev1.EventTypeNormal, "SuccessfulDelete", "Deleted job %s/%s", child.Namespace, child.Name)
-			klog.V(4).Infof("Deleted resource %s/%s successfully", child.Namespace, child.Name)
+	deadline := now.Add(-retention.Duration)
+	for i := n; i < len(children); i++ {
+		if t := getJobFinishedTime(children[i]); t == nil || !t.Time.Before(deadline) {
+			break
 		}
+		n++
 	}
+
+	return n
+}
+
+type historyLimits struct {
+	succeeded int
+	failed    int
 }
 
-func (r *Reconciler) updateParent(parent *customapiv1.AWSSQSWorkerJob, child *batchv1.Job) (err error) {
-	if child == nil {
-		return nil
+func getHistoryLimits(spec *customapiv1.AWSSQSWorkerJobSpec) historyLimits {
+	limit := defaultHistoryLimit
+	if spec.HistoryLimit != nil {
+		limit = int(*spec.HistoryLimit)
 	}
 
-	cpy := parent.DeepCopy()
-	cpy.Status.StartTime = child.Status.StartTime
-	cpy.Status.CompletionTime = child.Status.CompletionTime
-	cpy.Status.Succeeded = false
-	if finishedStatus := getJobFinishedStatus(child); finishedStatus == batchv1.JobComplete {
-		cpy.Status.Succeeded = true
+	limits := historyLimits{succeeded: limit, failed: limit}
+	if spec.SuccessfulJobsHistoryLimit != nil {
+		limits.succeeded = int(*spec.SuccessfulJobsHistoryLimit)
+	}
+	if spec.FailedJobsHistoryLimit != nil {
+		limits.failed = int(*spec.FailedJobsHistoryLimit)
 	}
 
-	_, err = r.client.Custom.SupercaracalV1().AWSSQSWorkerJobs(parent.Namespace).Update(context.TODO(), cpy, updOpts)
-	return
+	return limits
 }
 
-func extractChildren(parent *customapiv1.AWSSQSWorkerJob, jobs []*batchv1.Job, size int) []*batchv1.Job {
-	children := make([]*batchv1.Job, 0, size)
+func extractChildren(parent *customapiv1.AWSSQSWorkerJob, jobs []*batchv1.Job) (succeeded, failed []*batchv1.Job) {
 	for _, job := range jobs {
-		if getJobFinishedStatus(job) != "" && metav1.IsControlledBy(job, parent) {
-			children = append(children, job)
+		// Jobs must be counted in the status before they are deleted.
+		if hasPendingMessage(job) || !isCounted(job) || !metav1.IsControlledBy(job, parent) {
+			continue
+		}
+
+		switch getJobFinishedStatus(job) {
+		case batchv1.JobComplete:
+			succeeded = append(succeeded, job)
+		case batchv1.JobFailed:
+			failed = append(failed, job)
 		}
 	}
 
-	return children
+	return
 }
 
 func getJobFinishedStatus(job *batchv1.Job) batchv1.JobConditionType {
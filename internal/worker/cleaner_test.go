@@ -1,8 +1,128 @@
 package worker
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
 )
 
-func TestTODOCleaner(t *testing.T) {
+func TestGetHistoryLimits(t *testing.T) {
+	zero := int32(0)
+	three := int32(3)
+	five := int32(5)
+
+	cases := []struct {
+		spec customapiv1.AWSSQSWorkerJobSpec
+		want historyLimits
+	}{
+		{customapiv1.AWSSQSWorkerJobSpec{}, historyLimits{succeeded: defaultHistoryLimit, failed: defaultHistoryLimit}},
+		{customapiv1.AWSSQSWorkerJobSpec{HistoryLimit: &three}, historyLimits{succeeded: 3, failed: 3}},
+		{customapiv1.AWSSQSWorkerJobSpec{HistoryLimit: &three, SuccessfulJobsHistoryLimit: &zero}, historyLimits{succeeded: 0, failed: 3}},
+		{customapiv1.AWSSQSWorkerJobSpec{SuccessfulJobsHistoryLimit: &zero, FailedJobsHistoryLimit: &five}, historyLimits{succeeded: 0, failed: 5}},
+	}
+
+	for i, c := range cases {
+		if got := getHistoryLimits(&c.spec); got != c.want {
+			t.Errorf("%d: want=%+v, got=%+v", i, c.want, got)
+		}
+	}
+}
+
+func TestCountDeletable(t *testing.T) {
+	now := time.Now()
+	children := make([]*batchv1.Job, 0, 4)
+	for _, ago := range []time.Duration{4 * time.Hour, 3 * time.Hour, 2 * time.Hour, time.Minute} {
+		finished := metav1.NewTime(now.Add(-ago))
+		children = append(children, &batchv1.Job{Status: batchv1.JobStatus{CompletionTime: &finished}})
+	}
+
+	cases := []struct {
+		limit     int
+		retention *metav1.Duration
+		want      int
+	}{
+		{10, nil, 0},
+		{1, nil, 3},
+		{10, &metav1.Duration{Duration: 24 * time.Hour}, 0},
+		{10, &metav1.Duration{Duration: 150 * time.Minute}, 2},
+		{3, &metav1.Duration{Duration: 210 * time.Minute}, 1},
+		{1, &metav1.Duration{Duration: time.Hour}, 3},
+		{10, &metav1.Duration{Duration: time.Second}, 4},
+	}
+
+	for i, c := range cases {
+		if got := countDeletable(children, c.limit, c.retention, now); got != c.want {
+			t.Errorf("%d: want=%d, got=%d", i, c.want, got)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	one := int32(1)
+	two := int32(2)
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec:       customapiv1.AWSSQSWorkerJobSpec{SuccessfulJobsHistoryLimit: &one, FailedJobsHistoryLimit: &two},
+	}
+
+	statuses := []batchv1.JobConditionType{
+		batchv1.JobComplete, batchv1.JobFailed, batchv1.JobComplete, batchv1.JobFailed,
+		batchv1.JobComplete, batchv1.JobFailed, "",
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	cli := kubefake.NewSimpleClientset()
+	for i, s := range statuses {
+		started := metav1.Unix(int64(i), 0)
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            fmt.Sprintf("child-%d", i),
+				Namespace:       "default",
+				Annotations:     map[string]string{annotationCounted: "true"},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(parent, customGroup)},
+			},
+			Status: batchv1.JobStatus{StartTime: &started},
+		}
+		if s != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: s, Status: corev1.ConditionTrue}}
+		}
+		if err := indexer.Add(job); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cli.BatchV1().Jobs("default").Create(context.TODO(), job, creOpts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+	if err := r.clean(parent); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		got = append(got, job.Name)
+	}
+
+	want := []string{"child-3", "child-4", "child-5", "child-6"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
 }
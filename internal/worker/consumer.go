@@ -2,6 +2,9 @@ package worker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -9,30 +12,32 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
 	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
 	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
 )
 
+const (
+	jobNameHashLength = 16
+)
+
 var (
 	one         int32 = 1
 	customGroup       = customapiv1.SchemeGroupVersion.WithKind("AWSSQSWorkerJob")
 	creOpts           = metav1.CreateOptions{}
 )
 
-// WithMessageQueueService is
-func (r *Reconciler) WithMessageQueueService(region string, endpointURL string) (err error) {
-	r.messageQueue, err = queues.NewSQSClient(region, endpointURL)
-	return
-}
-
-// Consume is
-func (r *Reconciler) Consume() {
-	objs, err := r.lister.CustomResource.List(labels.Everything())
+func (r *Reconciler) consume(key string, stopCh <-chan struct{}) {
+	obj, err := r.getCustomResource(key)
 	if err != nil {
 		if !kubeerrors.IsNotFound(err) {
 			utilruntime.HandleError(err)
@@ -40,57 +45,436 @@ func (r *Reconciler) Consume() {
 		return
 	}
 
-	for _, obj := range objs {
-		if err := r.dequeueAndCreateJob(obj); err != nil {
-			utilruntime.HandleError(err)
-		}
+	// The consumer may run until the reconciler stops it after the spec gets suspended.
+	if obj.Spec.Suspend {
+		return
+	}
+
+	if err := r.dequeueAndCreateJob(obj, stopCh); err != nil {
+		utilruntime.HandleError(err)
 	}
 }
 
-func (r *Reconciler) dequeueAndCreateJob(obj *customapiv1.AWSSQSWorkerJob) error {
+func (r *Reconciler) dequeueAndCreateJob(obj *customapiv1.AWSSQSWorkerJob, stopCh <-chan struct{}) error {
+	if len(obj.Spec.Template.Spec.Containers) == 0 {
+		return fmt.Errorf("Unable to make Job from template in %s/%s: no containers, make sure the OpenAPI schema in your CRD manifest", obj.Namespace, obj.Name)
+	}
+
+	if _, err := findTargetContainer(&obj.Spec.Template.Spec, obj.Spec.TargetContainer); err != nil {
+		return fmt.Errorf("Unable to make Job from template in %s/%s: %w", obj.Namespace, obj.Name, err)
+	}
+
+	active, err := r.countActiveChildren(obj)
+	if err != nil {
+		return err
+	}
+
+	q, err := r.queueFor(obj)
+	if err != nil {
+		return err
+	}
+
 	for {
-		msg, err := r.messageQueue.Dequeue(obj.Spec.QueueURL)
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+
+		opts := buildReceiveOptions(obj, active)
+		if opts == nil {
+			break
+		}
+
+		msgs, err := q.Receive(obj.Spec.QueueURL, opts)
 		if err != nil {
 			return err
 		}
 
-		if msg == "" {
+		if len(msgs) == 0 {
 			break
 		}
+		r.markReceived(obj.Namespace + "/" + obj.Name)
+
+		errs := make([]error, 0, len(msgs))
+		jobs := make([]*batchv1.Job, 0, len(msgs))
+		handles := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			job, err := buildChildJob(obj, msg)
+			if err != nil {
+				r.recorder.Eventf(obj, corev1.EventTypeWarning, "InvalidMessage", "Unable to make job from message %s: %v", msg.ID, err)
+				if err := r.rejectMessage(obj, msg, err); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			jobs = append(jobs, job)
+			handles = append(handles, msg.ReceiptHandle)
+		}
+
+		// Jobs are created only for the deleted messages. The others are received again after their visibility timeout.
+		if obj.Spec.MessageDeletionPolicy != customapiv1.DeleteOnJobSucceeded && len(handles) > 0 {
+			if err := q.Delete(obj.Spec.QueueURL, handles...); err != nil {
+				errs = append(errs, err)
+				jobs = excludeUndeletedMessages(jobs, handles, queues.FailedReceiptHandles(err, handles))
+			}
+		}
+
+		for _, job := range jobs {
+			created, err := r.createChildJob(obj, job)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if created == nil {
+				continue
+			}
+			job = created
+
+			active++
+			metrics.JobsCreated.WithLabelValues(obj.Namespace, obj.Name).Inc()
+			klog.V(4).Infof("Created Job %s for %s/%s", job.Name, obj.Namespace, obj.Name)
+			r.recorder.Eventf(obj, corev1.EventTypeNormal, "SuccessfulCreate", "Created job %s/%s", job.Namespace, job.Name)
+		}
+
+		if len(errs) > 0 {
+			return utilerrors.NewAggregate(errs)
+		}
+	}
+
+	return nil
+}
+
+// The jobs correspond to the receipt handles one by one.
+func excludeUndeletedMessages(jobs []*batchv1.Job, handles, failed []string) []*batchv1.Job {
+	undeleted := make(map[string]struct{}, len(failed))
+	for _, h := range failed {
+		undeleted[h] = struct{}{}
+	}
+
+	deleted := make([]*batchv1.Job, 0, len(jobs))
+	for i, job := range jobs {
+		if _, ok := undeleted[handles[i]]; !ok {
+			deleted = append(deleted, job)
+		}
+	}
 
-		job, err := r.createChildJob(obj, msg)
+	return deleted
+}
+
+// The job of a redelivered message already exists since the name is derived from the message.
+// A failed one has released the message to be retried, so that the retry job is created with an attempt index.
+// It returns nil without an error if an existing job takes over the message.
+func (r *Reconciler) createChildJob(obj *customapiv1.AWSSQSWorkerJob, job *batchv1.Job) (*batchv1.Job, error) {
+	name := job.Name
+	for attempt := 1; ; attempt++ {
+		created, err := r.client.Builtin.BatchV1().Jobs(job.Namespace).Create(context.TODO(), job, creOpts)
+		if err == nil {
+			return created, nil
+		}
+		if !kubeerrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("Unable to create Job in %s/%s: %v", obj.Namespace, obj.Name, err)
+		}
+
+		existing, err := r.client.Builtin.BatchV1().Jobs(job.Namespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
 		if err != nil {
-			return fmt.Errorf("Unable to make Job from template in %s/%s: %v", obj.Namespace, obj.Name, err)
+			return nil, fmt.Errorf("Unable to get Job %s/%s: %w", job.Namespace, job.Name, err)
 		}
 
-		klog.V(4).Infof("Created Job %s for %s/%s", job.Name, obj.Namespace, obj.Name)
-		r.recorder.Eventf(obj, corev1.EventTypeNormal, "SuccessfulCreate", "Created job %s/%s", job.Namespace, job.Name)
+		if !metav1.IsControlledBy(existing, obj) {
+			return nil, fmt.Errorf("Job %s/%s already exists and is not controlled by %s/%s", job.Namespace, job.Name, obj.Namespace, obj.Name)
+		}
+
+		if getJobFinishedStatus(existing) != batchv1.JobFailed {
+			return nil, r.adoptRedeliveredMessage(job)
+		}
+
+		job.Name = fmt.Sprintf("%s-%d", name, attempt)
 	}
+}
 
+// It takes over the message so that the message is acknowledged according to the result of the job.
+func (r *Reconciler) adoptRedeliveredMessage(job *batchv1.Job) error {
+	annotations := make(map[string]string, 2)
+	for _, k := range []string{annotationReceiptHandle, annotationMessageBody} {
+		if v, ok := job.Annotations[k]; ok {
+			annotations[k] = v
+		}
+	}
+
+	if len(annotations) > 0 {
+		patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+		if err != nil {
+			return err
+		}
+
+		if _, err := r.client.Builtin.BatchV1().Jobs(job.Namespace).Patch(context.TODO(), job.Name, types.MergePatchType, patch, patOpts); err != nil {
+			return fmt.Errorf("Unable to hand over redelivered message to Job %s/%s: %w", job.Namespace, job.Name, err)
+		}
+	}
+
+	klog.V(4).Infof("Job %s/%s already exists for redelivered message", job.Namespace, job.Name)
 	return nil
 }
 
-func (r *Reconciler) createChildJob(obj *customapiv1.AWSSQSWorkerJob, msg string) (*batchv1.Job, error) {
+// The FIFO deduplication ID is not used since it only deduplicates messages for a while,
+// and the content-based one is shared by all of the messages with the same body.
+func hashMessageID(msg *queues.Message) string {
+	sum := sha256.Sum256([]byte(msg.ID))
+	return hex.EncodeToString(sum[:])[:jobNameHashLength]
+}
+
+func findTargetContainer(spec *corev1.PodSpec, name string) (*corev1.Container, error) {
+	if name == "" {
+		return &spec.Containers[0], nil
+	}
+
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return &spec.Containers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("target container %s is not found in template", name)
+}
+
+func injectArgs(container *corev1.Container, args []string, mode customapiv1.InjectionMode) {
+	if args == nil {
+		return
+	}
+
+	switch mode {
+	case customapiv1.InjectAppendArgs:
+		container.Args = append(container.Args, args...)
+	case customapiv1.InjectCommand:
+		container.Command = args
+	default:
+		container.Args = args
+	}
+}
+
+func buildChildJobSpec(tpl *customapiv1.JobTemplate) batchv1.JobSpec {
+	spec := batchv1.JobSpec{
+		Parallelism:             &one,
+		Completions:             &one,
+		BackoffLimit:            &one,
+		ActiveDeadlineSeconds:   tpl.ActiveDeadlineSeconds,
+		TTLSecondsAfterFinished: tpl.TTLSecondsAfterFinished,
+		PodFailurePolicy:        tpl.PodFailurePolicy,
+	}
+
+	if tpl.Parallelism != nil {
+		spec.Parallelism = tpl.Parallelism
+	}
+	if tpl.Completions != nil {
+		spec.Completions = tpl.Completions
+	}
+	if tpl.BackoffLimit != nil {
+		spec.BackoffLimit = tpl.BackoffLimit
+	}
+
+	return *spec.DeepCopy()
+}
+
+// The latter takes precedence over the former.
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(base) == 0 {
+		return override
+	}
+
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+func (r *Reconciler) countActiveChildren(obj *customapiv1.AWSSQSWorkerJob) (int, error) {
+	if obj.Spec.MaxConcurrentJobs == nil {
+		return 0, nil
+	}
+
+	jobs, err := r.lister.Job.Jobs(obj.Namespace).List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+
+	var active int
+	for _, job := range jobs {
+		if getJobFinishedStatus(job) == "" && metav1.IsControlledBy(job, obj) {
+			active++
+		}
+	}
+
+	return active, nil
+}
+
+func buildReceiveOptions(obj *customapiv1.AWSSQSWorkerJob, active int) *queues.ReceiveOptions {
+	size := queues.MaxReceiveSize
+	if obj.Spec.ReceiveBatchSize != nil {
+		size = int(*obj.Spec.ReceiveBatchSize)
+	}
+
+	if obj.Spec.MaxConcurrentJobs != nil {
+		remaining := int(*obj.Spec.MaxConcurrentJobs) - active
+		if remaining <= 0 {
+			return nil
+		}
+		if size > remaining {
+			size = remaining
+		}
+	}
+
+	var wait time.Duration
+	if obj.Spec.ReceiveWaitTimeSeconds != nil {
+		wait = time.Duration(*obj.Spec.ReceiveWaitTimeSeconds) * time.Second
+	}
+
+	opts := queues.ReceiveOptions{MaxMessages: size, WaitTime: wait}
+	if obj.Spec.MaxConcurrentJobs != nil {
+		opts.MaxInFlight = int(*obj.Spec.MaxConcurrentJobs)
+	}
+
+	return &opts
+}
+
+// The message is left in the queue to be retried unless the dead-letter queue is specified.
+func (r *Reconciler) rejectMessage(obj *customapiv1.AWSSQSWorkerJob, msg *queues.Message, reason error) error {
+	if obj.Spec.DeadLetterQueueURL == "" {
+		return nil
+	}
+
+	q, err := r.queueFor(obj)
+	if err != nil {
+		return err
+	}
+
+	dlq, err := r.deadLetterQueueFor(obj)
+	if err != nil {
+		return err
+	}
+
+	letter := queues.Message{
+		ID:         msg.ID,
+		Body:       msg.Body,
+		Attributes: map[string]string{attrFailureReason: "InvalidMessage", attrFailureMessage: reason.Error()},
+	}
+
+	if err := dlq.Send(obj.Spec.DeadLetterQueueURL, &letter); err != nil {
+		return fmt.Errorf("Unable to move invalid message %s to dead-letter queue: %w", msg.ID, err)
+	}
+
+	if err := q.Delete(obj.Spec.QueueURL, msg.ReceiptHandle); err != nil {
+		return fmt.Errorf("Unable to delete invalid message %s: %w", msg.ID, err)
+	}
+
+	r.recorder.Eventf(obj, corev1.EventTypeWarning, "MovedToDeadLetter", "Moved invalid message %s to dead-letter queue", msg.ID)
+	return nil
+}
+
+func buildChildJob(obj *customapiv1.AWSSQSWorkerJob, msg *queues.Message) (*batchv1.Job, error) {
+	input, err := parseMessage(&obj.Spec, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := hashMessageID(msg)
+	data := buildTemplateData(msg)
+	if obj.Spec.JobNameSuffix != "" {
+		if suffix, err = renderString(obj.Spec.JobNameSuffix, data); err != nil {
+			return nil, err
+		}
+	}
+
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:            fmt.Sprintf("%s-%d", obj.Name, time.Now().UnixMicro()),
+			Name:            fmt.Sprintf("%s-%s", obj.Name, suffix),
 			Namespace:       obj.Namespace,
+			Labels:          mergeMaps(obj.Spec.JobTemplate.Labels, input.Labels),
+			Annotations:     mergeMaps(obj.Spec.JobTemplate.Annotations, input.Annotations),
 			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(obj, customGroup)},
 		},
-		Spec: batchv1.JobSpec{
-			Parallelism:  &one,
-			Completions:  &one,
-			BackoffLimit: &one,
-		},
+		Spec: buildChildJobSpec(&obj.Spec.JobTemplate),
+	}
+
+	if job.Annotations == nil {
+		job.Annotations = make(map[string]string, 3)
+	}
+
+	if obj.Spec.MessageDeletionPolicy == customapiv1.DeleteOnJobSucceeded {
+		job.Annotations[annotationReceiptHandle] = msg.ReceiptHandle
+	}
+
+	if obj.Spec.DeadLetterQueueURL != "" {
+		job.Annotations[annotationMessageBody] = msg.Body
+	}
+
+	// The job must outlive the acknowledgement of its message even if the webhook is not installed.
+	if hasPendingMessage(job) {
+		job.Spec.TTLSecondsAfterFinished = nil
 	}
 
 	obj.Spec.Template.DeepCopyInto(&job.Spec.Template)
-	if len(job.Spec.Template.Spec.Containers) == 0 {
-		return nil, fmt.Errorf("failed to copy custom resource data, make sure the OpenAPI schema in your CRD manifest")
+	if obj.Spec.RenderTemplate {
+		if err := renderPodTemplate(&job.Spec.Template, data); err != nil {
+			return nil, err
+		}
 	}
 
-	job.Spec.Template.Spec.Containers[0].Args = strings.Split(msg, " ")
+	container, err := findTargetContainer(&job.Spec.Template.Spec, obj.Spec.TargetContainer)
+	if err != nil {
+		return nil, err
+	}
+	injectArgs(container, input.Args, obj.Spec.InjectionMode)
+	container.Env = append(container.Env, input.Env...)
+	if err := injectMetadata(job, container, msg); err != nil {
+		return nil, err
+	}
 	job.Spec.Template.Spec.RestartPolicy = "Never"
 
-	return r.client.Builtin.BatchV1().Jobs(obj.Namespace).Create(context.TODO(), job, creOpts)
+	if err := validateChildJob(job, container); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// The fields given by the message are validated before it is deleted since the job can't be created with invalid ones.
+func validateChildJob(job *batchv1.Job, container *corev1.Container) error {
+	// The name is also used as the value of the job-name label of the pods.
+	if errs := append(validation.IsDNS1123Subdomain(job.Name), validation.IsValidLabelValue(job.Name)...); len(errs) > 0 {
+		return fmt.Errorf("invalid job name %s: %s", job.Name, strings.Join(errs, ", "))
+	}
+
+	for _, labels := range []map[string]string{job.Labels, job.Spec.Template.Labels} {
+		for k, v := range labels {
+			if errs := append(validation.IsQualifiedName(k), validation.IsValidLabelValue(v)...); len(errs) > 0 {
+				return fmt.Errorf("invalid label %s=%s: %s", k, v, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	for k := range job.Annotations {
+		if errs := validation.IsQualifiedName(strings.ToLower(k)); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation %s: %s", k, strings.Join(errs, ", "))
+		}
+	}
+
+	// The message body kept for the dead-letter queue may not fit in annotations.
+	if err := apivalidation.ValidateAnnotationsSize(job.Annotations); err != nil {
+		return err
+	}
+
+	for _, env := range container.Env {
+		if errs := validation.IsEnvVarName(env.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid env %s: %s", env.Name, strings.Join(errs, ", "))
+		}
+	}
+
+	return nil
 }
@@ -1,8 +1,505 @@
 package worker
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
 )
 
-func TestTODOConsumer(t *testing.T) {
+func TestDequeueAndCreateJob(t *testing.T) {
+	two := int32(2)
+
+	cases := []struct {
+		desc     string
+		limit    *int32
+		running  int
+		messages int
+		created  int
+	}{
+		{desc: "without limit", limit: nil, running: 1, messages: 3, created: 3},
+		{desc: "under limit", limit: &two, running: 0, messages: 3, created: 2},
+		{desc: "partially over limit", limit: &two, running: 1, messages: 3, created: 1},
+		{desc: "fully over limit", limit: &two, running: 2, messages: 3, created: 0},
+	}
+
+	for n, c := range cases {
+		parent := &customapiv1.AWSSQSWorkerJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+			Spec: customapiv1.AWSSQSWorkerJobSpec{
+				QueueURL:          "http://127.0.0.1:4566/000000000000/test-queue",
+				MaxConcurrentJobs: c.limit,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+				},
+			},
+		}
+
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		for i := 0; i < c.running; i++ {
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            fmt.Sprintf("running-%d", i),
+					Namespace:       "default",
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(parent, customGroup)},
+				},
+			}
+			if err := indexer.Add(job); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		q := &recordingQueue{extended: map[string]time.Duration{}}
+		for i := 0; i < c.messages; i++ {
+			q.messages = append(q.messages, &queues.Message{ID: fmt.Sprint(i), Body: "Hello", ReceiptHandle: fmt.Sprint(i)})
+		}
+
+		cli := kubefake.NewSimpleClientset()
+		r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+		r.WithQueueRegistry(registryForTest(q))
+
+		if err := r.dequeueAndCreateJob(parent, nil); err != nil {
+			t.Fatalf("%d: %s: %v", n, c.desc, err)
+		}
+
+		jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(jobs.Items); got != c.created {
+			t.Errorf("%d: %s: created: want=%d, got=%d", n, c.desc, c.created, got)
+		}
+		if got := len(q.messages); got != c.messages-c.created {
+			t.Errorf("%d: %s: left: want=%d, got=%d", n, c.desc, c.messages-c.created, got)
+		}
+	}
+}
+
+func TestDequeuePartiallyDeletedMessages(t *testing.T) {
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			QueueURL: "http://127.0.0.1:4566/000000000000/test-queue",
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+	}
+
+	q := &recordingQueue{extended: map[string]time.Duration{}, undeletable: map[string]bool{"1": true}}
+	for i := 0; i < 3; i++ {
+		q.messages = append(q.messages, &queues.Message{ID: fmt.Sprint(i), Body: "Hello", ReceiptHandle: fmt.Sprint(i)})
+	}
+
+	cli := kubefake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+	r.WithQueueRegistry(registryForTest(q))
+
+	if err := r.dequeueAndCreateJob(parent, nil); err == nil {
+		t.Error("error is expected for the undeleted message")
+	}
+
+	jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(jobs.Items); got != 2 {
+		t.Fatalf("jobs: want=%d, got=%d", 2, got)
+	}
+	for _, job := range jobs.Items {
+		if job.Name == "parent-"+hashMessageID(&queues.Message{ID: "1"}) {
+			t.Errorf("job should not be created for the undeleted message: %s", job.Name)
+		}
+	}
+}
+
+func TestBuildReceiveOptions(t *testing.T) {
+	three := int32(3)
+	five := int32(5)
+	twenty := int32(20)
+
+	cases := []struct {
+		desc   string
+		spec   customapiv1.AWSSQSWorkerJobSpec
+		active int
+		want   *queues.ReceiveOptions
+	}{
+		{desc: "default", spec: customapiv1.AWSSQSWorkerJobSpec{}, active: 0, want: &queues.ReceiveOptions{MaxMessages: queues.MaxReceiveSize}},
+		{desc: "custom", spec: customapiv1.AWSSQSWorkerJobSpec{ReceiveBatchSize: &three, ReceiveWaitTimeSeconds: &twenty}, active: 0, want: &queues.ReceiveOptions{MaxMessages: 3, WaitTime: 20 * time.Second}},
+		{desc: "capped by limit", spec: customapiv1.AWSSQSWorkerJobSpec{MaxConcurrentJobs: &five}, active: 3, want: &queues.ReceiveOptions{MaxMessages: 2, MaxInFlight: 5}},
+		{desc: "limit reached", spec: customapiv1.AWSSQSWorkerJobSpec{MaxConcurrentJobs: &five}, active: 5, want: nil},
+	}
+
+	for n, c := range cases {
+		got := buildReceiveOptions(&customapiv1.AWSSQSWorkerJob{Spec: c.spec}, c.active)
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%d: %s: %s", n, c.desc, diff)
+		}
+	}
+}
+
+func TestDequeueInvalidMessage(t *testing.T) {
+	large := fmt.Sprintf(`{"foo":"%s"}`, strings.Repeat("a", 256*1024))
+
+	cases := []struct {
+		desc       string
+		deadLetter string
+		body       string
+		deleted    bool
+		sent       bool
+	}{
+		{desc: "without dead-letter queue", deadLetter: "", body: `{"bar":"baz"}`, deleted: false, sent: false},
+		{desc: "with dead-letter queue", deadLetter: "http://127.0.0.1:4566/000000000000/test-dlq", body: `{"bar":"baz"}`, deleted: true, sent: true},
+		{desc: "too large for annotations", deadLetter: "http://127.0.0.1:4566/000000000000/test-dlq", body: large, deleted: true, sent: true},
+	}
+
+	for n, c := range cases {
+		parent := &customapiv1.AWSSQSWorkerJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+			Spec: customapiv1.AWSSQSWorkerJobSpec{
+				QueueURL:           "http://127.0.0.1:4566/000000000000/test-queue",
+				DeadLetterQueueURL: c.deadLetter,
+				RenderTemplate:     true,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox", Args: []string{"{{ .body.foo }}"}}}},
+				},
+			},
+		}
+
+		q := &recordingQueue{extended: map[string]time.Duration{}}
+		q.messages = []*queues.Message{{ID: "1", Body: c.body, ReceiptHandle: "1"}}
+
+		cli := kubefake.NewSimpleClientset()
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		rec := record.NewFakeRecorder(10)
+		r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, rec)
+		r.WithQueueRegistry(registryForTest(q))
+
+		if err := r.dequeueAndCreateJob(parent, nil); err != nil {
+			t.Fatalf("%d: %s: %v", n, c.desc, err)
+		}
+
+		jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs.Items) != 0 {
+			t.Errorf("%d: %s: no jobs should be created: %d", n, c.desc, len(jobs.Items))
+		}
+		if got := len(q.deleted) > 0; got != c.deleted {
+			t.Errorf("%d: %s: deleted: want=%t, got=%t", n, c.desc, c.deleted, got)
+		}
+		if got := len(q.sent) > 0; got != c.sent {
+			t.Errorf("%d: %s: sent: want=%t, got=%t", n, c.desc, c.sent, got)
+		}
+		if len(rec.Events) == 0 {
+			t.Errorf("%d: %s: warning event should be recorded", n, c.desc)
+		}
+	}
+}
+
+func TestBuildChildJobSpec(t *testing.T) {
+	zero := int32(0)
+	three := int32(3)
+	sixty := int64(60)
+	policy := &batchv1.PodFailurePolicy{Rules: []batchv1.PodFailurePolicyRule{{
+		Action:          batchv1.PodFailurePolicyActionFailJob,
+		OnExitCodes:     &batchv1.PodFailurePolicyOnExitCodesRequirement{Operator: batchv1.PodFailurePolicyOnExitCodesOpIn, Values: []int32{42}},
+		OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{},
+	}}}
+
+	cases := []struct {
+		tpl  customapiv1.JobTemplate
+		want batchv1.JobSpec
+	}{
+		{
+			tpl:  customapiv1.JobTemplate{},
+			want: batchv1.JobSpec{Parallelism: &one, Completions: &one, BackoffLimit: &one},
+		},
+		{
+			tpl:  customapiv1.JobTemplate{Parallelism: &three, Completions: &three, BackoffLimit: &zero, ActiveDeadlineSeconds: &sixty, TTLSecondsAfterFinished: &zero},
+			want: batchv1.JobSpec{Parallelism: &three, Completions: &three, BackoffLimit: &zero, ActiveDeadlineSeconds: &sixty, TTLSecondsAfterFinished: &zero},
+		},
+		{
+			tpl:  customapiv1.JobTemplate{PodFailurePolicy: policy},
+			want: batchv1.JobSpec{Parallelism: &one, Completions: &one, BackoffLimit: &one, PodFailurePolicy: policy},
+		},
+	}
+
+	for n, c := range cases {
+		if diff := cmp.Diff(c.want, buildChildJobSpec(&c.tpl)); diff != "" {
+			t.Errorf("%d: %s", n, diff)
+		}
+	}
+}
+
+func TestBuildChildJobWithoutTTL(t *testing.T) {
+	ttl := int32(0)
+	cases := []struct {
+		policy customapiv1.MessageDeletionPolicy
+		dlq    string
+		want   *int32
+	}{
+		{policy: customapiv1.DeleteOnReceive, want: &ttl},
+		{policy: customapiv1.DeleteOnJobSucceeded, want: nil},
+		{policy: customapiv1.DeleteOnReceive, dlq: "http://127.0.0.1:4566/000000000000/dead", want: nil},
+	}
+
+	for n, c := range cases {
+		obj := &customapiv1.AWSSQSWorkerJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default"},
+			Spec: customapiv1.AWSSQSWorkerJobSpec{
+				MessageDeletionPolicy: c.policy,
+				DeadLetterQueueURL:    c.dlq,
+				JobTemplate:           customapiv1.JobTemplate{TTLSecondsAfterFinished: &ttl},
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+				},
+			},
+		}
+
+		job, err := buildChildJob(obj, &queues.Message{ID: "1", Body: "Hello", ReceiptHandle: "handle"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(c.want, job.Spec.TTLSecondsAfterFinished); diff != "" {
+			t.Errorf("%d: %s", n, diff)
+		}
+	}
+}
+
+func TestBuildChildJobWithInvalidFields(t *testing.T) {
+	cases := []struct {
+		desc   string
+		suffix string
+		labels map[string]string
+		body   string
+		err    bool
+	}{
+		{desc: "valid", suffix: "{{ .body.id }}", labels: map[string]string{"id": "{{ .body.id }}"}, body: `{"id":"a1","env":{"FOO":"bar"},"labels":{"app":"x"},"annotations":{"example.com/note":"long text"}}`},
+		{desc: "invalid name", suffix: "{{ .body.id }}", body: `{"id":"A_1"}`, err: true},
+		{desc: "too long name", suffix: "{{ .body.id }}", body: fmt.Sprintf(`{"id":"%064d"}`, 0), err: true},
+		{desc: "invalid rendered label", labels: map[string]string{"id": "{{ .body.id }}"}, body: `{"id":"a b"}`, err: true},
+		{desc: "invalid label value", body: `{"labels":{"app":"a b"}}`, err: true},
+		{desc: "invalid label key", body: `{"labels":{"a b":"x"}}`, err: true},
+		{desc: "invalid annotation key", body: `{"annotations":{"a b":"x"}}`, err: true},
+		{desc: "invalid env name", body: `{"env":{"1FOO":"bar"}}`, err: true},
+	}
+
+	for n, c := range cases {
+		obj := &customapiv1.AWSSQSWorkerJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default"},
+			Spec: customapiv1.AWSSQSWorkerJobSpec{
+				MessageFormat:  customapiv1.MessageFormatJSON,
+				RenderTemplate: true,
+				JobNameSuffix:  c.suffix,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: c.labels},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+				},
+			},
+		}
+
+		_, err := buildChildJob(obj, &queues.Message{ID: "1", Body: c.body, ReceiptHandle: "handle"})
+		if (err != nil) != c.err {
+			t.Errorf("%d: %s: unexpected error: %v", n, c.desc, err)
+		}
+	}
+}
+
+func TestMergeMaps(t *testing.T) {
+	cases := []struct {
+		base     map[string]string
+		override map[string]string
+		want     map[string]string
+	}{
+		{nil, nil, nil},
+		{nil, map[string]string{"a": "1"}, map[string]string{"a": "1"}},
+		{map[string]string{"a": "1"}, nil, map[string]string{"a": "1"}},
+		{map[string]string{"a": "1", "b": "2"}, map[string]string{"b": "3"}, map[string]string{"a": "1", "b": "3"}},
+	}
+
+	for n, c := range cases {
+		if diff := cmp.Diff(c.want, mergeMaps(c.base, c.override)); diff != "" {
+			t.Errorf("%d: %s", n, diff)
+		}
+	}
+}
+
+func TestInjectMessageIntoTargetContainer(t *testing.T) {
+	cases := []struct {
+		desc    string
+		target  string
+		mode    customapiv1.InjectionMode
+		command []string
+		args    []string
+		err     bool
+	}{
+		{desc: "default", target: "", mode: "", command: nil, args: []string{"Hello", "world"}},
+		{desc: "replace", target: "main", mode: customapiv1.InjectReplaceArgs, command: []string{"echo"}, args: []string{"Hello", "world"}},
+		{desc: "append", target: "main", mode: customapiv1.InjectAppendArgs, command: []string{"echo"}, args: []string{"--verbose", "Hello", "world"}},
+		{desc: "command", target: "main", mode: customapiv1.InjectCommand, command: []string{"Hello", "world"}, args: []string{"--verbose"}},
+		{desc: "not found", target: "missing", err: true},
+	}
+
+	for n, c := range cases {
+		parent := &customapiv1.AWSSQSWorkerJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+			Spec: customapiv1.AWSSQSWorkerJobSpec{
+				TargetContainer: c.target,
+				InjectionMode:   c.mode,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{Name: "proxy", Image: "envoy", Args: []string{"default"}},
+							{Name: "main", Image: "busybox", Command: []string{"echo"}, Args: []string{"--verbose"}},
+						},
+					},
+				},
+			},
+		}
+
+		job, err := buildChildJob(parent, &queues.Message{ID: "1", Body: "Hello world"})
+		if c.err {
+			if err == nil {
+				t.Errorf("%d: %s: error is expected", n, c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: %s: %v", n, c.desc, err)
+		}
+
+		target := job.Spec.Template.Spec.Containers[0]
+		if c.target != "" {
+			target = job.Spec.Template.Spec.Containers[1]
+		}
+		if diff := cmp.Diff(c.command, target.Command); diff != "" {
+			t.Errorf("%d: %s: command: %s", n, c.desc, diff)
+		}
+		if diff := cmp.Diff(c.args, target.Args); diff != "" {
+			t.Errorf("%d: %s: args: %s", n, c.desc, diff)
+		}
+		if len(target.Env) == 0 {
+			t.Errorf("%d: %s: metadata should be injected into target container", n, c.desc)
+		}
+	}
+}
+
+func TestHashMessageID(t *testing.T) {
+	cases := []struct {
+		a    queues.Message
+		b    queues.Message
+		same bool
+	}{
+		{queues.Message{ID: "1"}, queues.Message{ID: "1", ReceiptHandle: "redelivered"}, true},
+		{queues.Message{ID: "1"}, queues.Message{ID: "2"}, false},
+		{queues.Message{ID: "1", DeduplicationID: "x"}, queues.Message{ID: "2", DeduplicationID: "x"}, false},
+	}
+
+	for n, c := range cases {
+		a, b := hashMessageID(&c.a), hashMessageID(&c.b)
+		if len(a) != jobNameHashLength {
+			t.Errorf("%d: length: want=%d, got=%d", n, jobNameHashLength, len(a))
+		}
+		if (a == b) != c.same {
+			t.Errorf("%d: want=%t, got=%s, %s", n, c.same, a, b)
+		}
+	}
+}
+
+func TestDequeueRedeliveredMessage(t *testing.T) {
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			QueueURL:              "http://127.0.0.1:4566/000000000000/test-queue",
+			MessageDeletionPolicy: customapiv1.DeleteOnJobSucceeded,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+	}
+
+	msg := &queues.Message{ID: "1", Body: "Hello", ReceiptHandle: "first"}
+	existing, err := buildChildJob(parent, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := kubefake.NewSimpleClientset(existing)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+	r.WithQueueRegistry(registryForTest(&recordingQueue{
+		extended: map[string]time.Duration{},
+		messages: []*queues.Message{{ID: "1", Body: "Hello", ReceiptHandle: "second"}},
+	}))
+
+	if err := r.dequeueAndCreateJob(parent, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(jobs.Items); got != 1 {
+		t.Fatalf("jobs: want=%d, got=%d", 1, got)
+	}
+	if got := jobs.Items[0].Annotations[annotationReceiptHandle]; got != "second" {
+		t.Errorf("receipt handle: want=%s, got=%s", "second", got)
+	}
+}
+
+func TestDequeueMessageWithSameDeduplicationID(t *testing.T) {
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			QueueURL: "http://127.0.0.1:4566/000000000000/test-queue.fifo",
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+	}
+
+	// The content-based deduplication ID of the same body is shared by the message sent after the deduplication interval.
+	finished, err := buildChildJob(parent, &queues.Message{ID: "1", Body: "Hello", DeduplicationID: "hash-of-hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+
+	cli := kubefake.NewSimpleClientset(finished)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	r := NewReconciler(&ResourceClient{Builtin: cli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+	r.WithQueueRegistry(registryForTest(&recordingQueue{
+		extended: map[string]time.Duration{},
+		messages: []*queues.Message{{ID: "2", Body: "Hello", ReceiptHandle: "second", DeduplicationID: "hash-of-hello"}},
+	}))
+
+	if err := r.dequeueAndCreateJob(parent, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(jobs.Items); got != 2 {
+		t.Errorf("another message with the same deduplication ID should run: want=%d, got=%d", 2, got)
+	}
 }
@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	customapi "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+const (
+	reservedKeyPrefix = customapi.GroupName + "/"
+)
+
+type jobInput struct {
+	Args        []string
+	Env         []corev1.EnvVar
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+type jsonMessage struct {
+	Args        []string          `json:"args"`
+	Env         map[string]string `json:"env"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func parseMessage(spec *customapiv1.AWSSQSWorkerJobSpec, body string) (*jobInput, error) {
+	switch spec.MessageFormat {
+	case "", customapiv1.MessageFormatSplit:
+		return &jobInput{Args: strings.Split(body, " ")}, nil
+	case customapiv1.MessageFormatRaw:
+		if spec.MessageEnvName != "" {
+			return &jobInput{Env: []corev1.EnvVar{{Name: spec.MessageEnvName, Value: body}}}, nil
+		}
+		return &jobInput{Args: []string{body}}, nil
+	case customapiv1.MessageFormatShellWords:
+		args, err := splitShellWords(body)
+		if err != nil {
+			return nil, err
+		}
+		return &jobInput{Args: args}, nil
+	case customapiv1.MessageFormatJSON:
+		return parseJSONMessage(body)
+	default:
+		return nil, fmt.Errorf("unknown message format: %s", spec.MessageFormat)
+	}
+}
+
+func parseJSONMessage(body string) (*jobInput, error) {
+	var msg jsonMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse message as JSON: %w", err)
+	}
+
+	// Keys of the controller are reserved so that messages can't make it acknowledge or count anything else.
+	for _, m := range []map[string]string{msg.Labels, msg.Annotations} {
+		for k := range m {
+			if strings.HasPrefix(k, reservedKeyPrefix) {
+				return nil, fmt.Errorf("reserved key %s is not allowed in message", k)
+			}
+		}
+	}
+
+	input := jobInput{Args: msg.Args, Labels: msg.Labels, Annotations: msg.Annotations}
+	if len(msg.Env) > 0 {
+		input.Env = make([]corev1.EnvVar, 0, len(msg.Env))
+		for k, v := range msg.Env {
+			input.Env = append(input.Env, corev1.EnvVar{Name: k, Value: v})
+		}
+		sort.Slice(input.Env, func(i, j int) bool { return input.Env[i].Name < input.Env[j].Name })
+	}
+
+	return &input, nil
+}
+
+// It follows the quoting rules of POSIX shell except for any expansions.
+func splitShellWords(s string) ([]string, error) {
+	words := make([]string, 0, strings.Count(s, " ")+1)
+
+	var word strings.Builder
+	var inWord, escaped bool
+	var quote rune
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			if quote == '"' && c != '"' && c != '\\' && c != '$' && c != '`' && c != '\n' {
+				word.WriteRune('\\')
+			}
+			if c != '\n' { // line continuation
+				word.WriteRune(c)
+			}
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("failed to split message into words: trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("failed to split message into words: unterminated quote %c", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+func TestParseMessage(t *testing.T) {
+	cases := []struct {
+		desc string
+		spec customapiv1.AWSSQSWorkerJobSpec
+		body string
+		want *jobInput
+		err  bool
+	}{
+		{
+			desc: "default",
+			spec: customapiv1.AWSSQSWorkerJobSpec{},
+			body: "Hello world",
+			want: &jobInput{Args: []string{"Hello", "world"}},
+		},
+		{
+			desc: "raw as arg",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatRaw},
+			body: "Hello world",
+			want: &jobInput{Args: []string{"Hello world"}},
+		},
+		{
+			desc: "raw as env",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatRaw, MessageEnvName: "MESSAGE"},
+			body: "Hello world",
+			want: &jobInput{Env: []corev1.EnvVar{{Name: "MESSAGE", Value: "Hello world"}}},
+		},
+		{
+			desc: "shell words",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatShellWords},
+			body: `echo 'Hello world' "it's" a\ b`,
+			want: &jobInput{Args: []string{"echo", "Hello world", "it's", "a b"}},
+		},
+		{
+			desc: "broken shell words",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatShellWords},
+			body: `echo 'Hello`,
+			err:  true,
+		},
+		{
+			desc: "json",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatJSON},
+			body: `{"args":["Hello world"],"env":{"B":"2","A":"1"},"labels":{"app":"foo"},"annotations":{"note":"bar"}}`,
+			want: &jobInput{
+				Args:        []string{"Hello world"},
+				Env:         []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}},
+				Labels:      map[string]string{"app": "foo"},
+				Annotations: map[string]string{"note": "bar"},
+			},
+		},
+		{
+			desc: "reserved annotation",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatJSON},
+			body: `{"annotations":{"supercaracal.example.com/receipt-handle":"other"}}`,
+			err:  true,
+		},
+		{
+			desc: "reserved label",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatJSON},
+			body: `{"labels":{"supercaracal.example.com/counted":"true"}}`,
+			err:  true,
+		},
+		{
+			desc: "broken json",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: customapiv1.MessageFormatJSON},
+			body: `{"args":`,
+			err:  true,
+		},
+		{
+			desc: "unknown format",
+			spec: customapiv1.AWSSQSWorkerJobSpec{MessageFormat: "xml"},
+			body: "<foo/>",
+			err:  true,
+		},
+	}
+
+	for n, c := range cases {
+		got, err := parseMessage(&c.spec, c.body)
+		if (err != nil) != c.err {
+			t.Errorf("%d: %s: unexpected error: %v", n, c.desc, err)
+			continue
+		}
+
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%d: %s: %s", n, c.desc, diff)
+		}
+	}
+}
+
+func TestSplitShellWords(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: "", want: []string{}},
+		{in: "  foo   bar  ", want: []string{"foo", "bar"}},
+		{in: `'a "b" c'`, want: []string{`a "b" c`}},
+		{in: `"a \"b\" \c"`, want: []string{`a "b" \c`}},
+		{in: `'\'`, want: []string{`\`}},
+		{in: `''`, want: []string{""}},
+		{in: `foo"bar"'baz'`, want: []string{"foobarbaz"}},
+		{in: "foo\\\nbar", want: []string{"foobar"}},
+		{in: "foo\tbar\nbaz", want: []string{"foo", "bar", "baz"}},
+		{in: `foo\`, err: true},
+		{in: `"foo`, err: true},
+	}
+
+	for n, c := range cases {
+		got, err := splitShellWords(c.in)
+		if (err != nil) != c.err {
+			t.Errorf("%d: unexpected error: %v", n, err)
+			continue
+		}
+
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%d: %s", n, diff)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package worker
 
 import (
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // JobsOrderedByStartTimeASC is
@@ -30,3 +32,47 @@ func (aj JobsOrderedByStartTimeASC) Less(i, j int) bool {
 
 	return aj[i].Status.StartTime.Before(aj[j].Status.StartTime)
 }
+
+// JobsOrderedByCompletionTimeASC is
+type JobsOrderedByCompletionTimeASC []*batchv1.Job
+
+func (aj JobsOrderedByCompletionTimeASC) Len() int {
+	return len(aj)
+}
+
+func (aj JobsOrderedByCompletionTimeASC) Swap(i, j int) {
+	aj[i], aj[j] = aj[j], aj[i]
+}
+
+func (aj JobsOrderedByCompletionTimeASC) Less(i, j int) bool {
+	ti, tj := getJobFinishedTime(aj[i]), getJobFinishedTime(aj[j])
+
+	if ti == nil && tj != nil {
+		return false
+	}
+
+	if ti != nil && tj == nil {
+		return true
+	}
+
+	if ti.Equal(tj) {
+		return aj[i].Name < aj[j].Name
+	}
+
+	return ti.Before(tj)
+}
+
+// Failed jobs have no completion time, so that the transition time of the condition is used instead.
+func getJobFinishedTime(job *batchv1.Job) *metav1.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime
+	}
+
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return &c.LastTransitionTime
+		}
+	}
+
+	return nil
+}
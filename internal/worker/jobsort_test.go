@@ -1,8 +1,61 @@
 package worker
 
 import (
+	"sort"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func TestTODOJobSort(t *testing.T) {
+func TestJobsOrderedByStartTimeASC(t *testing.T) {
+	t1 := metav1.Unix(1, 0)
+	t2 := metav1.Unix(2, 0)
+
+	jobs := []*batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Name: "pending"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Status: batchv1.JobStatus{StartTime: &t2}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c"}, Status: batchv1.JobStatus{StartTime: &t1}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Status: batchv1.JobStatus{StartTime: &t2}},
+	}
+
+	sort.Sort(JobsOrderedByStartTimeASC(jobs))
+
+	if diff := cmp.Diff([]string{"c", "a", "b", "pending"}, jobNames(jobs)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestJobsOrderedByCompletionTimeASC(t *testing.T) {
+	t1 := metav1.Unix(1, 0)
+	t2 := metav1.Unix(2, 0)
+	t3 := metav1.Unix(3, 0)
+
+	jobs := []*batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Name: "running"}, Status: batchv1.JobStatus{StartTime: &t1}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "succeeded"}, Status: batchv1.JobStatus{StartTime: &t1, CompletionTime: &t3}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "failed"},
+			Status: batchv1.JobStatus{
+				StartTime:  &t2,
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: t2}},
+			},
+		},
+	}
+
+	sort.Sort(JobsOrderedByCompletionTimeASC(jobs))
+
+	if diff := cmp.Diff([]string{"failed", "succeeded", "running"}, jobNames(jobs)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func jobNames(jobs []*batchv1.Job) []string {
+	names := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		names = append(names, job.Name)
+	}
+	return names
 }
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapi "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal"
+)
+
+const (
+	envMessageID            = "SQS_MESSAGE_ID"
+	envSentTimestamp        = "SQS_MESSAGE_SENT_TIMESTAMP"
+	envReceiveCount         = "SQS_MESSAGE_RECEIVE_COUNT"
+	envGroupID              = "SQS_MESSAGE_GROUP_ID"
+	envAttributePrefix      = "SQS_MESSAGE_ATTRIBUTE_"
+	metadataTimestampLayout = time.RFC3339Nano
+)
+
+var (
+	annotationSentTimestamp = customapi.GroupName + "/message-sent-timestamp"
+	annotationReceiveCount  = customapi.GroupName + "/message-receive-count"
+	annotationGroupID       = customapi.GroupName + "/message-group-id"
+	annotationAttributes    = customapi.GroupName + "/message-attributes"
+)
+
+// The container receives the metadata as env vars and the job keeps them as annotations.
+func injectMetadata(job *batchv1.Job, container *corev1.Container, msg *queues.Message) error {
+	container.Env = append(container.Env, corev1.EnvVar{Name: envMessageID, Value: msg.ID})
+	job.Annotations[annotationMessageID] = msg.ID
+
+	if !msg.SentTimestamp.IsZero() {
+		ts := msg.SentTimestamp.UTC().Format(metadataTimestampLayout)
+		container.Env = append(container.Env, corev1.EnvVar{Name: envSentTimestamp, Value: ts})
+		job.Annotations[annotationSentTimestamp] = ts
+	}
+
+	if msg.ReceiveCount > 0 {
+		cnt := strconv.Itoa(msg.ReceiveCount)
+		container.Env = append(container.Env, corev1.EnvVar{Name: envReceiveCount, Value: cnt})
+		job.Annotations[annotationReceiveCount] = cnt
+	}
+
+	if msg.GroupID != "" {
+		container.Env = append(container.Env, corev1.EnvVar{Name: envGroupID, Value: msg.GroupID})
+		job.Annotations[annotationGroupID] = msg.GroupID
+	}
+
+	if len(msg.Attributes) == 0 {
+		return nil
+	}
+
+	attrs, err := json.Marshal(msg.Attributes)
+	if err != nil {
+		return err
+	}
+	job.Annotations[annotationAttributes] = string(attrs)
+
+	keys := make([]string, 0, len(msg.Attributes))
+	for k := range msg.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		container.Env = append(container.Env, corev1.EnvVar{Name: envAttributePrefix + toEnvName(k), Value: msg.Attributes[k]})
+	}
+
+	return nil
+}
+
+func toEnvName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, s)
+}
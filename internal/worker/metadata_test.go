@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+)
+
+func TestInjectMetadata(t *testing.T) {
+	cases := []struct {
+		desc        string
+		msg         *queues.Message
+		env         []corev1.EnvVar
+		annotations map[string]string
+	}{
+		{
+			desc:        "minimum",
+			msg:         &queues.Message{ID: "id"},
+			env:         []corev1.EnvVar{{Name: "FOO", Value: "bar"}, {Name: envMessageID, Value: "id"}},
+			annotations: map[string]string{annotationMessageID: "id"},
+		},
+		{
+			desc: "full",
+			msg: &queues.Message{
+				ID:            "id",
+				SentTimestamp: time.Date(2021, 10, 18, 0, 0, 0, 123000000, time.UTC),
+				ReceiveCount:  2,
+				GroupID:       "group",
+				Attributes:    map[string]string{"trace-id": "abc", "Tenant": "t1"},
+			},
+			env: []corev1.EnvVar{
+				{Name: "FOO", Value: "bar"},
+				{Name: envMessageID, Value: "id"},
+				{Name: envSentTimestamp, Value: "2021-10-18T00:00:00.123Z"},
+				{Name: envReceiveCount, Value: "2"},
+				{Name: envGroupID, Value: "group"},
+				{Name: envAttributePrefix + "TENANT", Value: "t1"},
+				{Name: envAttributePrefix + "TRACE_ID", Value: "abc"},
+			},
+			annotations: map[string]string{
+				annotationMessageID:     "id",
+				annotationSentTimestamp: "2021-10-18T00:00:00.123Z",
+				annotationReceiveCount:  "2",
+				annotationGroupID:       "group",
+				annotationAttributes:    `{"Tenant":"t1","trace-id":"abc"}`,
+			},
+		},
+	}
+
+	for n, c := range cases {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+		container := &corev1.Container{Env: []corev1.EnvVar{{Name: "FOO", Value: "bar"}}}
+
+		if err := injectMetadata(job, container, c.msg); err != nil {
+			t.Fatalf("%d: %s: %v", n, c.desc, err)
+		}
+
+		if diff := cmp.Diff(c.env, container.Env); diff != "" {
+			t.Errorf("%d: %s: env: %s", n, c.desc, diff)
+		}
+		if diff := cmp.Diff(c.annotations, job.Annotations); diff != "" {
+			t.Errorf("%d: %s: annotations: %s", n, c.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
+)
+
+// ObserveJobTransition is
+func ObserveJobTransition(before, after interface{}) {
+	prev, ok := before.(*batchv1.Job)
+	if !ok {
+		return
+	}
+
+	curr, ok := after.(*batchv1.Job)
+	if !ok {
+		return
+	}
+
+	ref := metav1.GetControllerOf(curr)
+	if ref == nil || ref.Kind != customGroup.Kind {
+		return
+	}
+
+	if prev.Status.StartTime == nil && curr.Status.StartTime != nil {
+		if sent, err := time.Parse(metadataTimestampLayout, curr.Annotations[annotationSentTimestamp]); err == nil {
+			metrics.JobStartLatency.WithLabelValues(curr.Namespace, ref.Name).Observe(curr.Status.StartTime.Sub(sent).Seconds())
+		}
+	}
+
+	if getJobFinishedStatus(prev) != "" {
+		return
+	}
+
+	switch getJobFinishedStatus(curr) {
+	case batchv1.JobComplete:
+		metrics.JobsSucceeded.WithLabelValues(curr.Namespace, ref.Name).Inc()
+	case batchv1.JobFailed:
+		metrics.JobsFailed.WithLabelValues(curr.Namespace, ref.Name).Inc()
+	}
+}
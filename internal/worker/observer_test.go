@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+func TestObserveJobTransition(t *testing.T) {
+	parent := &customapiv1.AWSSQSWorkerJob{ObjectMeta: metav1.ObjectMeta{Name: "observed", Namespace: "default", UID: "observed-uid"}}
+	sent := time.Date(2021, 10, 18, 0, 0, 0, 0, time.UTC)
+	started := metav1.NewTime(sent.Add(3 * time.Second))
+
+	pending := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "observed-1",
+			Namespace:       "default",
+			Annotations:     map[string]string{annotationSentTimestamp: sent.Format(metadataTimestampLayout)},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(parent, customGroup)},
+		},
+	}
+
+	running := pending.DeepCopy()
+	running.Status.StartTime = &started
+
+	succeeded := running.DeepCopy()
+	succeeded.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+
+	failed := running.DeepCopy()
+	failed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+
+	ObserveJobTransition(pending, running)
+	ObserveJobTransition(running, running)
+	ObserveJobTransition(running, succeeded)
+	ObserveJobTransition(succeeded, succeeded)
+	ObserveJobTransition(running, failed)
+
+	if got := testutil.CollectAndCount(metrics.JobStartLatency); got != 1 {
+		t.Errorf("start latency: want=%d, got=%d", 1, got)
+	}
+	if got := testutil.ToFloat64(metrics.JobsSucceeded.WithLabelValues("default", "observed")); got != 1 {
+		t.Errorf("succeeded: want=%d, got=%f", 1, got)
+	}
+	if got := testutil.ToFloat64(metrics.JobsFailed.WithLabelValues("default", "observed")); got != 1 {
+		t.Errorf("failed: want=%d, got=%f", 1, got)
+	}
+}
@@ -1,23 +1,44 @@
 package worker
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
 	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
 	customclient "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/clientset/versioned"
 	customlisterv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/listers/supercaracal/v1"
 )
 
+const (
+	resyncDuration = 10 * time.Second
+)
+
 // Reconciler is
 type Reconciler struct {
-	client       *ResourceClient
-	lister       *ResourceLister
-	workQueue    workqueue.RateLimitingInterface
-	recorder     record.EventRecorder
-	messageQueue queues.MessageQueue
+	client    *ResourceClient
+	lister    *ResourceLister
+	workQueue workqueue.RateLimitingInterface
+	recorder  record.EventRecorder
+	registry  *queues.Registry
+	queues    map[string]map[string]*cachedQueue
+	consumers map[string]*consumer
+	received  map[string]time.Time
+	counted   map[string]map[types.UID]struct{}
+	running   sync.WaitGroup
+	stopped   bool
+	mu        sync.Mutex
 }
 
 // ResourceClient is
@@ -40,5 +61,92 @@ func NewReconciler(
 	rec record.EventRecorder,
 ) *Reconciler {
 
-	return &Reconciler{client: cli, lister: list, workQueue: wq, recorder: rec}
+	return &Reconciler{client: cli, lister: list, workQueue: wq, recorder: rec, queues: make(map[string]map[string]*cachedQueue), consumers: make(map[string]*consumer), received: make(map[string]time.Time), counted: make(map[string]map[types.UID]struct{})}
+}
+
+// Work is
+func (r *Reconciler) Work() {
+	for r.processNextWorkItem() {
+	}
+}
+
+func (r *Reconciler) processNextWorkItem() bool {
+	item, shutdown := r.workQueue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.workQueue.Done(item)
+
+	key, ok := item.(string)
+	if !ok {
+		r.workQueue.Forget(item)
+		utilruntime.HandleError(fmt.Errorf("expected string in work queue but got %#v", item))
+		return true
+	}
+
+	if err := r.sync(key); err != nil {
+		r.workQueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error syncing %s: %w", key, err))
+		return true
+	}
+
+	r.workQueue.Forget(item)
+	return true
+}
+
+func (r *Reconciler) sync(key string) error {
+	obj, err := r.getCustomResource(key)
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			r.stopConsumer(key)
+			r.forgetQueues(key)
+			r.forgetMetrics(key)
+			return nil
+		}
+		return err
+	}
+
+	if obj.Spec.Suspend {
+		r.stopConsumer(key)
+	} else {
+		r.ensureConsumer(key, obj)
+	}
+
+	if err := r.clean(obj); err != nil {
+		return err
+	}
+
+	// The gauge is updated by the instrumented queue.
+	var qs queueState
+	if q, err := r.queueFor(obj); err != nil {
+		qs.err = err
+	} else {
+		qs.backlog, qs.err = q.CountMessages(obj.Spec.QueueURL)
+	}
+	if qs.err != nil {
+		utilruntime.HandleError(qs.err)
+	}
+
+	if err := r.updateStatus(obj, &qs); err != nil {
+		return err
+	}
+
+	// Jobs are watched but the visibility timeout of messages also needs to be extended periodically.
+	r.workQueue.AddAfter(key, resyncDuration)
+	return nil
+}
+
+func (r *Reconciler) forgetMetrics(key string) {
+	if namespace, name, err := cache.SplitMetaNamespaceKey(key); err == nil {
+		metrics.Forget(namespace, name)
+	}
+}
+
+func (r *Reconciler) getCustomResource(key string) (*customapiv1.AWSSQSWorkerJob, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.lister.CustomResource.AWSSQSWorkerJobs(namespace).Get(name)
 }
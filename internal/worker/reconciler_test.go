@@ -1,8 +1,253 @@
 package worker
 
 import (
+	"context"
 	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+	customfake "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/clientset/versioned/fake"
+	customlisterv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/listers/supercaracal/v1"
 )
 
-func TestTODOReconciler(t *testing.T) {
+func TestReconcile(t *testing.T) {
+	cases := []struct {
+		desc      string
+		policy    customapiv1.MessageDeletionPolicy
+		condition batchv1.JobConditionType
+		backlog   int32
+		active    int32
+		succeeded int64
+		failed    int64
+	}{
+		{desc: "running jobs", policy: customapiv1.DeleteOnJobSucceeded, condition: "", backlog: 0, active: 2},
+		{desc: "succeeded jobs", policy: customapiv1.DeleteOnJobSucceeded, condition: batchv1.JobComplete, backlog: 0, succeeded: 2},
+		{desc: "failed jobs", policy: customapiv1.DeleteOnJobSucceeded, condition: batchv1.JobFailed, backlog: 2, failed: 2},
+		{desc: "failed jobs of deleted messages", policy: customapiv1.DeleteOnReceive, condition: batchv1.JobFailed, backlog: 0, failed: 2},
+	}
+
+	for n, c := range cases {
+		obj := &customapiv1.AWSSQSWorkerJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+			Spec: customapiv1.AWSSQSWorkerJobSpec{
+				QueueURL:              "http://127.0.0.1:4566/000000000000/test-queue",
+				MessageDeletionPolicy: c.policy,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+				},
+			},
+		}
+		key := "default/parent"
+
+		mq := queues.NewMemoryQueue(queues.DefaultVisibilityTimeout)
+		for _, body := range []string{"echo foo", "echo bar"} {
+			if err := mq.Send(obj.Spec.QueueURL, &queues.Message{Body: body}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		jobIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		objIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		if err := objIndexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+
+		wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		kubeCli := kubefake.NewSimpleClientset()
+		customCli := customfake.NewSimpleClientset(obj)
+		r := NewReconciler(
+			&ResourceClient{Builtin: kubeCli, Custom: customCli},
+			&ResourceLister{Job: batchlisterv1.NewJobLister(jobIndexer), CustomResource: customlisterv1.NewAWSSQSWorkerJobLister(objIndexer)},
+			wq,
+			record.NewFakeRecorder(100),
+		)
+		r.WithQueueRegistry(registryForTest(mq))
+
+		// The consumer is driven by the test instead of the background one.
+		r.consumers[key] = newConsumer(&obj.Spec)
+		r.consume(key, make(chan struct{}))
+
+		jobs, err := kubeCli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs.Items) != 2 {
+			t.Errorf("%d: %s: created: want=2, got=%d", n, c.desc, len(jobs.Items))
+		}
+
+		for i := range jobs.Items {
+			job := &jobs.Items[i]
+			if c.condition != "" {
+				job.Status.Conditions = []batchv1.JobCondition{{Type: c.condition, Status: corev1.ConditionTrue}}
+				if _, err := kubeCli.BatchV1().Jobs("default").UpdateStatus(context.TODO(), job, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		// The first sync acknowledges the messages and the second one counts the jobs.
+		for i := 0; i < 2; i++ {
+			refreshJobs(t, kubeCli, jobIndexer)
+			if err := r.sync(key); err != nil {
+				t.Fatal(err)
+			}
+
+			updated, err := customCli.SupercaracalV1().AWSSQSWorkerJobs("default").Get(context.TODO(), "parent", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := objIndexer.Update(updated); err != nil {
+				t.Fatal(err)
+			}
+		}
+		wq.ShutDown()
+
+		obj, err = r.getCustomResource(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if obj.Status.ApproximateBacklog == nil || *obj.Status.ApproximateBacklog != c.backlog {
+			t.Errorf("%d: %s: backlog: want=%d, got=%v", n, c.desc, c.backlog, obj.Status.ApproximateBacklog)
+		}
+		if obj.Status.ActiveJobs != c.active {
+			t.Errorf("%d: %s: active: want=%d, got=%d", n, c.desc, c.active, obj.Status.ActiveJobs)
+		}
+		if obj.Status.SucceededJobs != c.succeeded {
+			t.Errorf("%d: %s: succeeded: want=%d, got=%d", n, c.desc, c.succeeded, obj.Status.SucceededJobs)
+		}
+		if obj.Status.FailedJobs != c.failed {
+			t.Errorf("%d: %s: failed: want=%d, got=%d", n, c.desc, c.failed, obj.Status.FailedJobs)
+		}
+	}
+}
+
+func TestRetryFailedJob(t *testing.T) {
+	obj := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			QueueURL:              "http://127.0.0.1:4566/000000000000/test-queue",
+			MessageDeletionPolicy: customapiv1.DeleteOnJobSucceeded,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+	}
+	key := "default/parent"
+
+	mq := queues.NewMemoryQueue(queues.DefaultVisibilityTimeout)
+	if err := mq.Send(obj.Spec.QueueURL, &queues.Message{Body: "echo foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	objIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := objIndexer.Add(obj); err != nil {
+		t.Fatal(err)
+	}
+
+	wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer wq.ShutDown()
+	kubeCli := kubefake.NewSimpleClientset()
+	r := NewReconciler(
+		&ResourceClient{Builtin: kubeCli, Custom: customfake.NewSimpleClientset(obj)},
+		&ResourceLister{Job: batchlisterv1.NewJobLister(jobIndexer), CustomResource: customlisterv1.NewAWSSQSWorkerJobLister(objIndexer)},
+		wq,
+		record.NewFakeRecorder(100),
+	)
+	r.WithQueueRegistry(registryForTest(mq))
+	r.consumers[key] = newConsumer(&obj.Spec)
+
+	// Each failed job releases the message and the redelivered message makes a retry job.
+	var names []string
+	for i, condition := range []batchv1.JobConditionType{batchv1.JobFailed, batchv1.JobFailed, batchv1.JobComplete} {
+		r.consume(key, make(chan struct{}))
+
+		jobs, err := kubeCli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs.Items) != i+1 {
+			t.Fatalf("%d: jobs: want=%d, got=%d", i, i+1, len(jobs.Items))
+		}
+
+		var created *batchv1.Job
+		for j := range jobs.Items {
+			if _, ok := jobs.Items[j].Annotations[annotationReceiptHandle]; ok {
+				if created != nil {
+					t.Fatalf("%d: only the latest job should have the message", i)
+				}
+				created = &jobs.Items[j]
+			}
+		}
+		if created == nil {
+			t.Fatalf("%d: no job has the message", i)
+		}
+		names = append(names, created.Name)
+
+		created.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+		if _, err := kubeCli.BatchV1().Jobs("default").UpdateStatus(context.TODO(), created, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		refreshJobs(t, kubeCli, jobIndexer)
+		if err := r.sync(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if names[1] != names[0]+"-1" || names[2] != names[0]+"-2" {
+		t.Errorf("unexpected job names: %v", names)
+	}
+	if n, err := mq.CountMessages(obj.Spec.QueueURL); err != nil || n != 0 {
+		t.Errorf("backlog: want=%d, got=(%d, %v)", 0, n, err)
+	}
+	if msgs, err := mq.Receive(obj.Spec.QueueURL, &queues.ReceiveOptions{MaxMessages: 1}); err != nil || len(msgs) != 0 {
+		t.Errorf("message should be deleted: %+v, %v", msgs, err)
+	}
+}
+
+func TestSyncDeletedCustomResource(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	lister := ResourceLister{CustomResource: customlisterv1.NewAWSSQSWorkerJobLister(indexer)}
+
+	r := NewReconciler(&ResourceClient{}, &lister, nil, record.NewFakeRecorder(10))
+	r.consumers["default/gone"] = newConsumer(&customapiv1.AWSSQSWorkerJobSpec{})
+	r.queues["default/gone"] = map[string]*cachedQueue{}
+
+	if err := r.sync("default/gone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.consumers["default/gone"]; ok {
+		t.Error("consumer should be stopped")
+	}
+	if _, ok := r.queues["default/gone"]; ok {
+		t.Error("queues should be forgotten")
+	}
+}
+
+func refreshJobs(t *testing.T, cli *kubefake.Clientset, indexer cache.Indexer) {
+	t.Helper()
+
+	jobs, err := cli.BatchV1().Jobs("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objs := make([]interface{}, 0, len(jobs.Items))
+	for i := range jobs.Items {
+		objs = append(objs, &jobs.Items[i])
+	}
+	if err := indexer.Replace(objs, ""); err != nil {
+		t.Fatal(err)
+	}
 }
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+)
+
+const (
+	templateDelimiter = "{{"
+)
+
+// The body is nil unless it is a JSON value so that referring to its fields fails.
+// Numbers are kept as they are written so that large integers such as IDs are not rendered in exponent notation.
+func buildTemplateData(msg *queues.Message) map[string]interface{} {
+	var body interface{}
+	dec := json.NewDecoder(strings.NewReader(msg.Body))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil || dec.Decode(&struct{}{}) != io.EOF {
+		body = nil
+	}
+
+	return map[string]interface{}{"body": body, "messageId": msg.ID}
+}
+
+func renderPodTemplate(tpl *corev1.PodTemplateSpec, data map[string]interface{}) error {
+	for k, v := range tpl.Labels {
+		rendered, err := renderString(v, data)
+		if err != nil {
+			return fmt.Errorf("failed to render label %s: %w", k, err)
+		}
+		tpl.Labels[k] = rendered
+	}
+
+	for i := range tpl.Spec.Containers {
+		if err := renderContainer(&tpl.Spec.Containers[i], data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func renderContainer(c *corev1.Container, data map[string]interface{}) error {
+	for i, arg := range c.Args {
+		rendered, err := renderString(arg, data)
+		if err != nil {
+			return fmt.Errorf("failed to render arg %d of container %s: %w", i, c.Name, err)
+		}
+		c.Args[i] = rendered
+	}
+
+	for i, env := range c.Env {
+		rendered, err := renderString(env.Value, data)
+		if err != nil {
+			return fmt.Errorf("failed to render env %s of container %s: %w", env.Name, c.Name, err)
+		}
+		c.Env[i].Value = rendered
+	}
+
+	return nil
+}
+
+func renderString(s string, data map[string]interface{}) (string, error) {
+	if !strings.Contains(s, templateDelimiter) {
+		return s, nil
+	}
+
+	tpl, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+)
+
+func TestRenderPodTemplate(t *testing.T) {
+	tpl := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"customer": "{{ .body.customerId }}", "app": "worker"}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "main",
+					Args: []string{"--customer={{ .body.customerId }}", "--plain"},
+					Env:  []corev1.EnvVar{{Name: "MESSAGE_ID", Value: "{{ .messageId }}"}, {Name: "NESTED", Value: "{{ .body.order.id }}"}},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		desc string
+		body string
+		want *corev1.PodTemplateSpec
+		err  bool
+	}{
+		{
+			desc: "json body",
+			body: `{"customerId":"c1","order":{"id":42}}`,
+			want: &corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"customer": "c1", "app": "worker"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "main",
+							Args: []string{"--customer=c1", "--plain"},
+							Env:  []corev1.EnvVar{{Name: "MESSAGE_ID", Value: "id1"}, {Name: "NESTED", Value: "42"}},
+						},
+					},
+				},
+			},
+		},
+		{desc: "missing field", body: `{"order":{"id":42}}`, err: true},
+		{desc: "not json", body: `Hello world`, err: true},
+	}
+
+	for n, c := range cases {
+		got := tpl.DeepCopy()
+		err := renderPodTemplate(got, buildTemplateData(&queues.Message{ID: "id1", Body: c.body}))
+		if (err != nil) != c.err {
+			t.Errorf("%d: %s: unexpected error: %v", n, c.desc, err)
+			continue
+		}
+
+		if c.err {
+			continue
+		}
+
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%d: %s: %s", n, c.desc, diff)
+		}
+	}
+}
+
+func TestRenderString(t *testing.T) {
+	data := map[string]interface{}{"body": map[string]interface{}{"foo": "bar"}}
+
+	cases := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "plain", want: "plain"},
+		{in: "{{ .body.foo }}", want: "bar"},
+		{in: "{{ .body.baz }}", err: true},
+		{in: "{{ .body.foo", err: true},
+	}
+
+	for n, c := range cases {
+		got, err := renderString(c.in, data)
+		if (err != nil) != c.err {
+			t.Errorf("%d: unexpected error: %v", n, err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("%d: want=%s, got=%s", n, c.want, got)
+		}
+	}
+}
+
+func TestBuildTemplateData(t *testing.T) {
+	cases := []struct {
+		body string
+		in   string
+		want string
+		err  bool
+	}{
+		{body: `{"customerId": 123456789}`, in: "{{ .body.customerId }}", want: "123456789"},
+		{body: `{"amount": 1.5, "ids": [9007199254740993]}`, in: "{{ .body.amount }} {{ index .body.ids 0 }}", want: "1.5 9007199254740993"},
+		{body: `{"foo": "bar"}`, in: "{{ .body.foo }} {{ .messageId }}", want: "bar id"},
+		{body: `{"foo": "bar"} trailing`, in: "{{ .body.foo }}", err: true},
+		{body: "plain text", in: "{{ .body.foo }}", err: true},
+	}
+
+	for n, c := range cases {
+		got, err := renderString(c.in, buildTemplateData(&queues.Message{ID: "id", Body: c.body}))
+		if (err != nil) != c.err {
+			t.Errorf("%d: unexpected error: %v", n, err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("%d: want=%s, got=%s", n, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	customapi "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+var (
+	annotationCounted = customapi.GroupName + "/counted"
+	countedPatch      = []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}}}`, annotationCounted))
+)
+
+type queueState struct {
+	backlog int
+	err     error
+}
+
+func (r *Reconciler) updateStatus(parent *customapiv1.AWSSQSWorkerJob, qs *queueState) error {
+	jobs, err := r.lister.Job.Jobs(parent.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	key := parent.Namespace + "/" + parent.Name
+	counted := r.countedJobs(key)
+
+	status := parent.Status.DeepCopy()
+	status.ObservedGeneration = parent.Generation
+	status.ActiveJobs = 0
+
+	// Jobs counted by the previous syncs are skipped even if the lister has not seen their annotation yet.
+	uncounted := make([]*batchv1.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if !metav1.IsControlledBy(job, parent) {
+			continue
+		}
+
+		switch getJobFinishedStatus(job) {
+		case "":
+			status.ActiveJobs++
+			continue
+		case batchv1.JobComplete:
+			if isCounted(job) || hasPendingMessage(job) {
+				continue
+			}
+			if _, ok := counted[job.UID]; !ok {
+				status.SucceededJobs++
+			}
+		case batchv1.JobFailed:
+			if isCounted(job) || hasPendingMessage(job) {
+				continue
+			}
+			if _, ok := counted[job.UID]; !ok {
+				status.FailedJobs++
+			}
+		}
+
+		uncounted = append(uncounted, job)
+	}
+
+	if t, ok := r.lastReceivedTime(key); ok {
+		if status.LastMessageReceivedTime == nil || status.LastMessageReceivedTime.Time.Before(t) {
+			status.LastMessageReceivedTime = &metav1.Time{Time: t}
+		}
+	}
+
+	if qs.err == nil {
+		backlog := int32(qs.backlog)
+		status.ApproximateBacklog = &backlog
+	}
+
+	setConditions(status, parent, qs.err)
+	r.recordSuspension(parent, status)
+
+	if !equality.Semantic.DeepEqual(status, &parent.Status) {
+		cpy := parent.DeepCopy()
+		cpy.Status = *status
+		if _, err := r.client.Custom.SupercaracalV1().AWSSQSWorkerJobs(parent.Namespace).UpdateStatus(context.TODO(), cpy, updOpts); err != nil {
+			return err
+		}
+	}
+
+	// A job may be counted twice if the controller restarts here, but it is never lost.
+	r.setCountedJobs(key, uncounted)
+	for _, job := range uncounted {
+		if _, err := r.client.Builtin.BatchV1().Jobs(job.Namespace).Patch(context.TODO(), job.Name, types.MergePatchType, countedPatch, patOpts); err != nil {
+			utilruntime.HandleError(fmt.Errorf("Unable to mark Job %s/%s as counted: %w", job.Namespace, job.Name, err))
+		}
+	}
+
+	return nil
+}
+
+func setConditions(status *customapiv1.AWSSQSWorkerJobStatus, parent *customapiv1.AWSSQSWorkerJob, queueErr error) {
+	gen := parent.Generation
+
+	if queueErr == nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionQueueReachable, Status: metav1.ConditionTrue, Reason: "QueueReachable", ObservedGeneration: gen})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionQueueReachable, Status: metav1.ConditionFalse, Reason: "QueueUnreachable", Message: queueErr.Error(), ObservedGeneration: gen})
+	}
+
+	if max := parent.Spec.MaxConcurrentJobs; max != nil && status.ActiveJobs >= *max {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionThrottled, Status: metav1.ConditionTrue, Reason: "MaxConcurrentJobsReached", ObservedGeneration: gen})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionThrottled, Status: metav1.ConditionFalse, Reason: "BelowMaxConcurrentJobs", ObservedGeneration: gen})
+	}
+
+	if parent.Spec.Suspend {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionSuspended, Status: metav1.ConditionTrue, Reason: "Suspended", ObservedGeneration: gen})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionSuspended, Status: metav1.ConditionFalse, Reason: "Resumed", ObservedGeneration: gen})
+	}
+
+	switch {
+	case parent.Spec.Suspend:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionReady, Status: metav1.ConditionFalse, Reason: "Suspended", Message: "Receiving messages is suspended", ObservedGeneration: gen})
+	case len(parent.Spec.Template.Spec.Containers) == 0:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionReady, Status: metav1.ConditionFalse, Reason: "NoContainers", Message: "The template has no containers", ObservedGeneration: gen})
+	case queueErr != nil:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionReady, Status: metav1.ConditionFalse, Reason: "QueueUnreachable", Message: queueErr.Error(), ObservedGeneration: gen})
+	default:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: customapiv1.ConditionReady, Status: metav1.ConditionTrue, Reason: "Consuming", ObservedGeneration: gen})
+	}
+}
+
+func (r *Reconciler) recordSuspension(parent *customapiv1.AWSSQSWorkerJob, status *customapiv1.AWSSQSWorkerJobStatus) {
+	prev := meta.FindStatusCondition(parent.Status.Conditions, customapiv1.ConditionSuspended)
+	curr := meta.IsStatusConditionTrue(status.Conditions, customapiv1.ConditionSuspended)
+
+	switch {
+	case curr && (prev == nil || prev.Status != metav1.ConditionTrue):
+		r.recorder.Event(parent, corev1.EventTypeNormal, "Suspended", "Suspended receiving messages")
+	case !curr && prev != nil && prev.Status == metav1.ConditionTrue:
+		r.recorder.Event(parent, corev1.EventTypeNormal, "Resumed", "Resumed receiving messages")
+	}
+}
+
+func (r *Reconciler) markReceived(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.received[key] = time.Now()
+}
+
+func (r *Reconciler) lastReceivedTime(key string) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.received[key]
+	return t, ok
+}
+
+func (r *Reconciler) countedJobs(key string) map[types.UID]struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counted[key]
+}
+
+// The jobs are remembered until the lister sees their annotation, so that the set is replaced at every sync.
+func (r *Reconciler) setCountedJobs(key string, jobs []*batchv1.Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(jobs) == 0 {
+		delete(r.counted, key)
+		return
+	}
+
+	counted := make(map[types.UID]struct{}, len(jobs))
+	for _, job := range jobs {
+		counted[job.UID] = struct{}{}
+	}
+	r.counted[key] = counted
+}
+
+func isCounted(job *batchv1.Job) bool {
+	_, ok := job.Annotations[annotationCounted]
+	return ok
+}
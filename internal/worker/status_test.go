@@ -0,0 +1,243 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+	customfake "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/clientset/versioned/fake"
+)
+
+func TestUpdateStatus(t *testing.T) {
+	two := int32(2)
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid", Generation: 3},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			MaxConcurrentJobs: &two,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+		Status: customapiv1.AWSSQSWorkerJobStatus{SucceededJobs: 5, FailedJobs: 1},
+	}
+
+	cases := []struct {
+		condition batchv1.JobConditionType
+		counted   bool
+	}{
+		{"", false},
+		{"", false},
+		{batchv1.JobComplete, false},
+		{batchv1.JobComplete, true},
+		{batchv1.JobFailed, false},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	objs := make([]*batchv1.Job, 0, len(cases))
+	for i, c := range cases {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            fmt.Sprintf("child-%d", i),
+				Namespace:       "default",
+				Annotations:     map[string]string{},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(parent, customGroup)},
+			},
+		}
+		if c.condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: c.condition, Status: corev1.ConditionTrue}}
+		}
+		if c.counted {
+			job.Annotations[annotationCounted] = "true"
+		}
+		if err := indexer.Add(job); err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, job)
+	}
+
+	kubeCli := kubefake.NewSimpleClientset(objs[0], objs[1], objs[2], objs[3], objs[4])
+	customCli := customfake.NewSimpleClientset(parent)
+	r := NewReconciler(&ResourceClient{Builtin: kubeCli, Custom: customCli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+	r.markReceived("default/parent")
+
+	if err := r.updateStatus(parent, &queueState{backlog: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := customCli.SupercaracalV1().AWSSQSWorkerJobs("default").Get(context.TODO(), "parent", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nums := []struct {
+		name string
+		want int64
+		got  int64
+	}{
+		{"observedGeneration", 3, got.Status.ObservedGeneration},
+		{"activeJobs", 2, int64(got.Status.ActiveJobs)},
+		{"succeededJobs", 6, got.Status.SucceededJobs},
+		{"failedJobs", 2, got.Status.FailedJobs},
+		{"approximateBacklog", 7, int64(*got.Status.ApproximateBacklog)},
+	}
+	for i, n := range nums {
+		if n.got != n.want {
+			t.Errorf("%d: %s: want=%d, got=%d", i, n.name, n.want, n.got)
+		}
+	}
+
+	if got.Status.LastMessageReceivedTime == nil {
+		t.Errorf("lastMessageReceivedTime is not set")
+	}
+
+	conds := []struct {
+		typ  string
+		want metav1.ConditionStatus
+	}{
+		{customapiv1.ConditionReady, metav1.ConditionTrue},
+		{customapiv1.ConditionQueueReachable, metav1.ConditionTrue},
+		{customapiv1.ConditionThrottled, metav1.ConditionTrue},
+	}
+	for i, c := range conds {
+		if !meta.IsStatusConditionPresentAndEqual(got.Status.Conditions, c.typ, c.want) {
+			t.Errorf("%d: %s: want=%s, got=%+v", i, c.typ, c.want, got.Status.Conditions)
+		}
+	}
+
+	for i, c := range cases {
+		job, err := kubeCli.BatchV1().Jobs("default").Get(context.TODO(), fmt.Sprintf("child-%d", i), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := c.condition != ""; isCounted(job) != want {
+			t.Errorf("%d: counted: want=%t, got=%t", i, want, isCounted(job))
+		}
+	}
+}
+
+func TestUpdateStatusWithStaleJobLister(t *testing.T) {
+	parent := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default", UID: "parent-uid"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "child",
+			Namespace:       "default",
+			UID:             "child-uid",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(parent, customGroup)},
+		},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(job); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeCli := kubefake.NewSimpleClientset(job)
+	customCli := customfake.NewSimpleClientset(parent)
+	r := NewReconciler(&ResourceClient{Builtin: kubeCli, Custom: customCli}, &ResourceLister{Job: batchlisterv1.NewJobLister(indexer)}, nil, record.NewFakeRecorder(10))
+
+	// The second sync is triggered by the status update before the lister sees the counted annotation.
+	for i, synced := range []bool{false, false, true} {
+		if synced {
+			patched, err := kubeCli.BatchV1().Jobs("default").Get(context.TODO(), "child", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := indexer.Update(patched); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		current, err := customCli.SupercaracalV1().AWSSQSWorkerJobs("default").Get(context.TODO(), "parent", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.updateStatus(current, &queueState{}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := customCli.SupercaracalV1().AWSSQSWorkerJobs("default").Get(context.TODO(), "parent", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.SucceededJobs != 1 {
+			t.Errorf("%d: succeededJobs: want=%d, got=%d", i, 1, got.Status.SucceededJobs)
+		}
+	}
+
+	if counted := r.countedJobs("default/parent"); len(counted) != 0 {
+		t.Errorf("counted jobs should be forgotten after the lister sees the annotation: %v", counted)
+	}
+}
+
+func TestSetConditions(t *testing.T) {
+	cases := []struct {
+		containers []corev1.Container
+		queueErr   error
+		want       string
+	}{
+		{[]corev1.Container{{Name: "main"}}, nil, "Consuming"},
+		{[]corev1.Container{{Name: "main"}}, fmt.Errorf("error"), "QueueUnreachable"},
+		{nil, nil, "NoContainers"},
+	}
+
+	for i, c := range cases {
+		parent := &customapiv1.AWSSQSWorkerJob{Spec: customapiv1.AWSSQSWorkerJobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: c.containers}}}}
+		var status customapiv1.AWSSQSWorkerJobStatus
+		setConditions(&status, parent, c.queueErr)
+		if got := meta.FindStatusCondition(status.Conditions, customapiv1.ConditionReady); got == nil || got.Reason != c.want {
+			t.Errorf("%d: want=%s, got=%+v", i, c.want, got)
+		}
+	}
+}
+
+func TestRecordSuspension(t *testing.T) {
+	suspended := []metav1.Condition{{Type: customapiv1.ConditionSuspended, Status: metav1.ConditionTrue}}
+	resumed := []metav1.Condition{{Type: customapiv1.ConditionSuspended, Status: metav1.ConditionFalse}}
+
+	cases := []struct {
+		before []metav1.Condition
+		after  []metav1.Condition
+		want   string
+	}{
+		{nil, suspended, "Normal Suspended Suspended receiving messages"},
+		{resumed, suspended, "Normal Suspended Suspended receiving messages"},
+		{suspended, resumed, "Normal Resumed Resumed receiving messages"},
+		{suspended, suspended, ""},
+		{nil, resumed, ""},
+	}
+
+	for i, c := range cases {
+		rec := record.NewFakeRecorder(1)
+		r := NewReconciler(&ResourceClient{}, &ResourceLister{}, nil, rec)
+		parent := &customapiv1.AWSSQSWorkerJob{Status: customapiv1.AWSSQSWorkerJobStatus{Conditions: c.before}}
+		r.recordSuspension(parent, &customapiv1.AWSSQSWorkerJobStatus{Conditions: c.after})
+
+		var got string
+		select {
+		case got = <-rec.Events:
+		default:
+		}
+		if got != c.want {
+			t.Errorf("%d: want=%q, got=%q", i, c.want, got)
+		}
+	}
+}
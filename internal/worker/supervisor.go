@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+)
+
+const (
+	consumingDuration = 1 * time.Second
+)
+
+type consumer struct {
+	spec   customapiv1.AWSSQSWorkerJobSpec
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newConsumer(spec *customapiv1.AWSSQSWorkerJobSpec) *consumer {
+	return &consumer{spec: *spec.DeepCopy(), stopCh: make(chan struct{}), doneCh: make(chan struct{})}
+}
+
+// The previous consumer must be done before running so that they don't consume the same queue at the same time.
+func (c *consumer) run(prev *consumer, f func(<-chan struct{})) {
+	defer close(c.doneCh)
+
+	if prev != nil {
+		select {
+		case <-prev.doneCh:
+		case <-c.stopCh:
+			return
+		}
+	}
+
+	wait.Until(func() { f(c.stopCh) }, consumingDuration, c.stopCh)
+}
+
+func (c *consumer) stop() {
+	close(c.stopCh)
+}
+
+func (r *Reconciler) ensureConsumer(key string, obj *customapiv1.AWSSQSWorkerJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return
+	}
+
+	prev, ok := r.consumers[key]
+	if ok {
+		if equality.Semantic.DeepEqual(prev.spec, obj.Spec) {
+			return
+		}
+
+		prev.stop()
+		klog.V(4).Infof("Restarting consumer for %s", key)
+	} else {
+		klog.V(4).Infof("Starting consumer for %s", key)
+	}
+
+	c := newConsumer(&obj.Spec)
+	r.consumers[key] = c
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		c.run(prev, func(stopCh <-chan struct{}) { r.consume(key, stopCh) })
+	}()
+}
+
+func (r *Reconciler) stopConsumer(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.consumers[key]
+	if !ok {
+		return
+	}
+
+	c.stop()
+	delete(r.consumers, key)
+	delete(r.received, key)
+	klog.V(4).Infof("Stopped consumer for %s", key)
+}
+
+// StopConsumers is
+// It waits for all of the consumers including the ones being stopped, and no consumers are started after that.
+func (r *Reconciler) StopConsumers() {
+	r.mu.Lock()
+	r.stopped = true
+	for key, c := range r.consumers {
+		c.stop()
+		delete(r.consumers, key)
+	}
+	r.mu.Unlock()
+
+	r.running.Wait()
+}
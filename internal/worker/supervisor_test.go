@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchlisterv1 "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	queues "github.com/supercaracal/aws-sqs-worker-job-controller/internal/queue"
+	customapiv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/apis/supercaracal/v1"
+	customfake "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/clientset/versioned/fake"
+	customlisterv1 "github.com/supercaracal/aws-sqs-worker-job-controller/pkg/generated/listers/supercaracal/v1"
+)
+
+func TestConsumerLifecycle(t *testing.T) {
+	obj := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec:       customapiv1.AWSSQSWorkerJobSpec{QueueURL: "http://127.0.0.1:4566/000000000000/test-queue1"},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(obj); err != nil {
+		t.Fatal(err)
+	}
+
+	wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer wq.ShutDown()
+
+	lister := ResourceLister{
+		Job:            batchlisterv1.NewJobLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		CustomResource: customlisterv1.NewAWSSQSWorkerJobLister(indexer),
+	}
+
+	r := NewReconciler(&ResourceClient{Custom: customfake.NewSimpleClientset(obj)}, &lister, wq, record.NewFakeRecorder(10))
+	r.WithQueueRegistry(registryForTest(&recordingQueue{extended: map[string]time.Duration{}}))
+	defer r.StopConsumers()
+
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	first, ok := r.consumers["default/foo"]
+	if !ok {
+		t.Fatal("consumer should be started")
+	}
+
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if r.consumers["default/foo"] != first {
+		t.Error("consumer should not be restarted without any changes")
+	}
+
+	changed := obj.DeepCopy()
+	changed.Spec.QueueURL = "http://127.0.0.1:4566/000000000000/test-queue2"
+	if err := indexer.Update(changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	second := r.consumers["default/foo"]
+	if second == first {
+		t.Error("consumer should be restarted after changing spec")
+	}
+
+	select {
+	case <-first.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Error("previous consumer should be stopped")
+	}
+
+	suspended := changed.DeepCopy()
+	suspended.Spec.Suspend = true
+	if err := indexer.Update(suspended); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.consumers["default/foo"]; ok {
+		t.Error("consumer should be stopped after suspension")
+	}
+
+	select {
+	case <-second.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Error("consumer should be done after suspension")
+	}
+
+	if err := indexer.Update(changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	third, ok := r.consumers["default/foo"]
+	if !ok {
+		t.Fatal("consumer should be started after resumption")
+	}
+
+	if err := indexer.Delete(changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.consumers["default/foo"]; ok {
+		t.Error("consumer should be stopped after deletion")
+	}
+
+	select {
+	case <-third.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Error("consumer should be done after deletion")
+	}
+}
+
+type blockingQueue struct {
+	recordingQueue
+	receiving chan struct{}
+	release   chan struct{}
+}
+
+func (q *blockingQueue) Receive(_ string, _ *queues.ReceiveOptions) ([]*queues.Message, error) {
+	select {
+	case q.receiving <- struct{}{}:
+	default:
+	}
+
+	<-q.release
+	return nil, nil
+}
+
+func TestStopConsumers(t *testing.T) {
+	obj := &customapiv1.AWSSQSWorkerJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: customapiv1.AWSSQSWorkerJobSpec{
+			QueueURL: "http://127.0.0.1:4566/000000000000/test-queue",
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+			},
+		},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(obj); err != nil {
+		t.Fatal(err)
+	}
+
+	wq := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer wq.ShutDown()
+
+	lister := ResourceLister{
+		Job:            batchlisterv1.NewJobLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		CustomResource: customlisterv1.NewAWSSQSWorkerJobLister(indexer),
+	}
+
+	q := &blockingQueue{recordingQueue: recordingQueue{extended: map[string]time.Duration{}}, receiving: make(chan struct{}, 1), release: make(chan struct{})}
+	r := NewReconciler(&ResourceClient{Custom: customfake.NewSimpleClientset(obj)}, &lister, wq, record.NewFakeRecorder(10))
+	r.WithQueueRegistry(registryForTest(q))
+
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-q.receiving:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer should receive messages")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		r.StopConsumers()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("it should wait for the consumer receiving messages")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(q.release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("it should return after the consumer is done")
+	}
+
+	if err := r.sync("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.consumers["default/foo"]; ok {
+		t.Error("consumer should not be started after stopping")
+	}
+}
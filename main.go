@@ -1,9 +1,13 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"k8s.io/client-go/rest"
@@ -11,11 +15,21 @@ import (
 	"k8s.io/klog/v2"
 
 	controllers "github.com/supercaracal/aws-sqs-worker-job-controller/internal/controller"
+	"github.com/supercaracal/aws-sqs-worker-job-controller/internal/metrics"
+	webhooks "github.com/supercaracal/aws-sqs-worker-job-controller/internal/webhook"
 )
 
 var (
-	masterURL  string
-	kubeconfig string
+	masterURL   string
+	kubeconfig  string
+	workers     int
+	metricsPort int
+	healthPort  int
+	leaderElect bool
+	leaseNS     string
+	leaseName   string
+	webhookPort int
+	certDir     string
 )
 
 func main() {
@@ -32,7 +46,20 @@ func main() {
 		klog.Fatal("Error building custom controller: ", err)
 	}
 
-	if err := ctrl.Run(setUpSignalHandler()); err != nil {
+	if leaderElect {
+		if err := ctrl.WithLeaderElection(leaseNS, leaseName); err != nil {
+			klog.Fatal("Error setting up leader election: ", err)
+		}
+	}
+
+	go serve("metrics", metricsPort, "/metrics", metrics.Handler())
+	go serve("health probes", healthPort, "/", ctrl.HealthHandler())
+
+	if certDir != "" {
+		go serveWebhook(webhookPort, certDir)
+	}
+
+	if err := ctrl.Run(setUpSignalHandler(), workers); err != nil {
 		klog.Fatal("Error running controller: ", err)
 	}
 }
@@ -51,6 +78,62 @@ func init() {
 		"",
 		"Path to a kubeconfig. Only required if out-of-cluster.",
 	)
+
+	flag.IntVar(
+		&workers,
+		"workers",
+		2,
+		"The number of workers which reconcile custom resources concurrently.",
+	)
+
+	flag.IntVar(
+		&metricsPort,
+		"metrics-port",
+		8080,
+		"The port number to serve Prometheus metrics on /metrics.",
+	)
+
+	flag.IntVar(
+		&healthPort,
+		"health-port",
+		8081,
+		"The port number to serve health probes on /healthz and /readyz.",
+	)
+
+	flag.BoolVar(
+		&leaderElect,
+		"leader-elect",
+		false,
+		"Enable leader election so that only one of replicas reconciles custom resources.",
+	)
+
+	flag.StringVar(
+		&leaseNS,
+		"leader-election-namespace",
+		os.Getenv("POD_NAMESPACE"),
+		"The namespace of the Lease object for leader election.",
+	)
+
+	flag.StringVar(
+		&leaseName,
+		"leader-election-id",
+		"aws-sqs-worker-job-controller",
+		"The name of the Lease object for leader election.",
+	)
+
+	flag.IntVar(
+		&webhookPort,
+		"webhook-port",
+		9443,
+		"The port number to serve the validating and defaulting admission webhooks.",
+	)
+
+	flag.StringVar(
+		&certDir,
+		"webhook-cert-dir",
+		"",
+		"The directory which has tls.crt and tls.key for the webhooks. The webhooks are disabled if it is empty.",
+	)
 }
 
 func buildConfig(masterURL, kubeconfig string) (*rest.Config, error) {
@@ -61,6 +144,37 @@ func buildConfig(masterURL, kubeconfig string) (*rest.Config, error) {
 	return clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 }
 
+func serve(what string, port int, pattern string, h http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle(pattern, h)
+
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux); err != nil {
+		klog.Fatalf("Error serving %s: %v", what, err)
+	}
+}
+
+// The certificate is loaded on each handshake since the secret volume may be populated or renewed after start.
+func serveWebhook(port int, dir string) {
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: webhooks.Handler(),
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+				if err != nil {
+					return nil, fmt.Errorf("Failed to load webhook certificate: %w", err)
+				}
+				return &cert, nil
+			},
+		},
+	}
+
+	if err := srv.ListenAndServeTLS("", ""); err != nil {
+		klog.Fatal("Error serving webhooks: ", err)
+	}
+}
+
 func setUpSignalHandler() <-chan struct{} {
 	stop := make(chan struct{})
 	c := make(chan os.Signal, 2)
@@ -1,6 +1,7 @@
 package v1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -9,39 +10,288 @@ import (
 
 // AWSSQSWorkerJob is
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=aswj
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Active",type=integer,JSONPath=`.status.activeJobs`
+// +kubebuilder:printcolumn:name="Succeeded",type=integer,JSONPath=`.status.succeededJobs`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failedJobs`
+// +kubebuilder:printcolumn:name="Backlog",type=integer,JSONPath=`.status.approximateBacklog`
+// +kubebuilder:printcolumn:name="Last Received",type=date,JSONPath=`.status.lastMessageReceivedTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type AWSSQSWorkerJob struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   AWSSQSWorkerJobSpec   `json:"spec"`
-	Status AWSSQSWorkerJobStatus `json:"status"`
+	Status AWSSQSWorkerJobStatus `json:"status,omitempty"`
 }
 
 // AWSSQSWorkerJobSpec is
 type AWSSQSWorkerJobSpec struct {
 	// The URL of the queue which is treated by the controller for tasks.
+	// The backend is selected by the scheme: https or http for AWS SQS,
+	// amqp or amqps for AMQP 0-9-1 brokers such as RabbitMQ, e.g. amqp://host:5672/vhost/queue,
+	// redis or rediss for Redis Streams with consumer groups, e.g. redis://host:6379/db/stream?group=name.
 	QueueURL string `json:"queueURL"`
 
+	// The Secret which has "username" and "password" keys for the queues.
+	// They are used as the user info of the URLs. AWS SQS doesn't use them.
+	// The Secret is read when the controller connects to the queue and the queue is reconnected when it is changed.
+	// The Secret must have the "supercaracal.example.com/allowed-queue-hosts" annotation
+	// which lists the hosts of the queues separated by commas, such as "rabbitmq:5672,redis".
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
 	// The number of finished jobs to retain.
 	// +optional
+	// +kubebuilder:validation:Minimum=0
 	HistoryLimit *int32 `json:"historyLimit,omitempty"`
 
+	// The number of successful finished jobs to retain. Defaults to historyLimit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+
+	// The number of failed finished jobs to retain. Defaults to historyLimit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+
+	// The duration for which finished jobs are retained regardless of the history limits, e.g. "24h".
+	// Finished jobs older than that are deleted even if the number of them is within the limits.
+	// +optional
+	FinishedJobsRetention *metav1.Duration `json:"finishedJobsRetention,omitempty"`
+
+	// The maximum number of child jobs which run concurrently.
+	// The controller stops receiving messages while the limit is reached.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentJobs *int32 `json:"maxConcurrentJobs,omitempty"`
+
+	// The maximum number of messages received at once.
+	// It must be between 1 and 10. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	ReceiveBatchSize *int32 `json:"receiveBatchSize,omitempty"`
+
+	// The duration in seconds for which the controller waits for messages arriving to the empty queue.
+	// It enables long polling if greater than 0. It must be between 0 and 20. Defaults to 0.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=20
+	ReceiveWaitTimeSeconds *int32 `json:"receiveWaitTimeSeconds,omitempty"`
+
+	// Specifies when the received message is deleted from the queue.
+	// Valid values are:
+	// - "OnReceive" (default): deletes the message as soon as it is received;
+	// - "OnJobSucceeded": keeps the message until the child job succeeds.
+	// +optional
+	MessageDeletionPolicy MessageDeletionPolicy `json:"messageDeletionPolicy,omitempty"`
+
+	// The URL of the queue which the message is moved to when the child job failed.
+	// The message body is kept in an annotation of the job to do so.
+	// Messages which don't fit in the size limit of annotations are moved to it without running jobs.
+	// +optional
+	DeadLetterQueueURL string `json:"deadLetterQueueURL,omitempty"`
+
+	// Specifies how the message body is mapped to the child job.
+	// Valid values are:
+	// - "split" (default): splits the body by spaces into the args of the container;
+	// - "raw": passes the whole body as a single arg, or as an env var if messageEnvName is set;
+	// - "shell-words": splits the body into the args by the quoting rules of shell;
+	// - "json": applies "args", "env", "labels" and "annotations" keys of the JSON object.
+	//   Labels and annotations prefixed with "supercaracal.example.com/" are reserved for the controller.
+	// +optional
+	MessageFormat MessageFormat `json:"messageFormat,omitempty"`
+
+	// The name of the environment variable which the message body is set to in the raw format.
+	// +optional
+	MessageEnvName string `json:"messageEnvName,omitempty"`
+
+	// Renders labels, args and env values in the template as Go templates with the message.
+	// The decoded JSON body and the message ID can be referred as {{ .body.foo }} and {{ .messageId }}.
+	// The message is not turned into a job if it fails to render.
+	// +optional
+	RenderTemplate bool `json:"renderTemplate,omitempty"`
+
+	// The suffix of the child job names, which is rendered as a Go template in the same way as the template.
+	// Defaults to a hash of the message ID so that a redelivered message does not create another job unless the previous one failed.
+	// Retry jobs of a failed message have the attempt index appended to the name.
+	// +optional
+	JobNameSuffix string `json:"jobNameSuffix,omitempty"`
+
+	// The name of the container which the message is injected into. Defaults to the first container.
+	// +optional
+	TargetContainer string `json:"targetContainer,omitempty"`
+
+	// Specifies how the args given by the message are injected into the target container.
+	// Valid values are:
+	// - "ReplaceArgs" (default): replaces the args of the container;
+	// - "AppendArgs": appends them to the args of the container;
+	// - "Command": replaces the command of the container.
+	// +optional
+	InjectionMode InjectionMode `json:"injectionMode,omitempty"`
+
+	// Stops receiving messages while it is true. Messages are left in the queue
+	// and finished jobs are still cleaned up. Defaults to false.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Defines settings of child jobs apart from the pod template.
+	// +optional
+	JobTemplate JobTemplate `json:"jobTemplate,omitempty"`
+
 	// Defines pods that will be created from this template.
 	Template corev1.PodTemplateSpec `json:"template"`
 }
 
+// JobTemplate describes settings of child jobs.
+type JobTemplate struct {
+	// Labels merged into child jobs. Labels given by messages take precedence over them.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations merged into child jobs. Annotations given by messages take precedence over them.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// The number of pods which run in parallel for a job. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Parallelism *int32 `json:"parallelism,omitempty"`
+
+	// The number of pods which must succeed for a job. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Completions *int32 `json:"completions,omitempty"`
+
+	// The number of retries before marking a job failed. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// The duration in seconds for which a job may be active before it is terminated.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// The duration in seconds after which a finished job is deleted by Kubernetes.
+	// It is not allowed with the OnJobSucceeded deletion policy or the dead-letter queue,
+	// since the message of the job must be acknowledged by the controller before the job is deleted.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// The policy to handle failed pods of a job, such as failing the job without retries on a certain exit code.
+	// It requires Kubernetes 1.25 or later with the JobPodFailurePolicy feature gate, which is enabled by default since 1.26.
+	// +optional
+	PodFailurePolicy *batchv1.PodFailurePolicy `json:"podFailurePolicy,omitempty"`
+}
+
+// MessageDeletionPolicy describes when the message is deleted from the queue.
+// +kubebuilder:validation:Enum=OnReceive;OnJobSucceeded
+type MessageDeletionPolicy string
+
+const (
+	// DeleteOnReceive deletes the message as soon as it is received.
+	// It is at-most-once delivery.
+	DeleteOnReceive MessageDeletionPolicy = "OnReceive"
+
+	// DeleteOnJobSucceeded keeps the message invisible in the queue while the child job is running
+	// and deletes it after the job succeeded. It is at-least-once delivery.
+	DeleteOnJobSucceeded MessageDeletionPolicy = "OnJobSucceeded"
+)
+
 // AWSSQSWorkerJobStatus is
 type AWSSQSWorkerJobStatus struct {
-	StartTime      *metav1.Time
-	CompletionTime *metav1.Time
-	Succeeded      bool
+	// The generation of the spec which the status reflects.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The latest observations of the state. Known types are Ready, QueueReachable, Throttled and Suspended.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// The number of child jobs which are not finished yet.
+	// +optional
+	ActiveJobs int32 `json:"activeJobs,omitempty"`
+
+	// The total number of child jobs which succeeded, including deleted ones.
+	// +optional
+	SucceededJobs int64 `json:"succeededJobs,omitempty"`
+
+	// The total number of child jobs which failed, including deleted ones.
+	// +optional
+	FailedJobs int64 `json:"failedJobs,omitempty"`
+
+	// The last time when the controller received messages from the queue.
+	// +optional
+	LastMessageReceivedTime *metav1.Time `json:"lastMessageReceivedTime,omitempty"`
+
+	// The approximate number of messages available in the queue.
+	// +optional
+	ApproximateBacklog *int32 `json:"approximateBacklog,omitempty"`
 }
 
+const (
+	// ConditionReady is true if the controller is able to turn messages into child jobs.
+	ConditionReady = "Ready"
+
+	// ConditionQueueReachable is true if the last API call to the queue succeeded.
+	ConditionQueueReachable = "QueueReachable"
+
+	// ConditionThrottled is true while the number of active child jobs reaches maxConcurrentJobs.
+	ConditionThrottled = "Throttled"
+
+	// ConditionSuspended is true while the spec suspends receiving messages.
+	ConditionSuspended = "Suspended"
+)
+
 // AWSSQSWorkerJobList is
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
 type AWSSQSWorkerJobList struct {
 	metav1.TypeMeta `json:",inline"`
 	metav1.ListMeta `json:"metadata"`
 
 	Items []AWSSQSWorkerJob `json:"items"`
 }
+
+// InjectionMode describes how the args given by the message are injected into the container.
+// +kubebuilder:validation:Enum=ReplaceArgs;AppendArgs;Command
+type InjectionMode string
+
+const (
+	// InjectReplaceArgs replaces the args of the container.
+	InjectReplaceArgs InjectionMode = "ReplaceArgs"
+
+	// InjectAppendArgs appends the args given by the message to the args of the container.
+	InjectAppendArgs InjectionMode = "AppendArgs"
+
+	// InjectCommand replaces the command of the container.
+	InjectCommand InjectionMode = "Command"
+)
+
+// MessageFormat describes how the message body is mapped to the child job.
+// +kubebuilder:validation:Enum=split;raw;shell-words;json
+type MessageFormat string
+
+const (
+	// MessageFormatSplit splits the message body by spaces into the args.
+	MessageFormatSplit MessageFormat = "split"
+
+	// MessageFormatRaw passes the whole message body as a single arg or an env var.
+	MessageFormatRaw MessageFormat = "raw"
+
+	// MessageFormatShellWords splits the message body into the args by the quoting rules of shell.
+	MessageFormatShellWords MessageFormat = "shell-words"
+
+	// MessageFormatJSON decodes the message body as a JSON object which has args, env, labels and annotations.
+	MessageFormatJSON MessageFormat = "json"
+)